@@ -22,7 +22,7 @@
 import { Command, EnumType } from "@cliffy/command";
 import { Confirm } from "@cliffy/prompt";
 import { outdent } from "@cspotcode/outdent";
-import { join } from "@std/path";
+import { isAbsolute, join } from "@std/path";
 import { Project } from "../lib/automate/project.ts";
 import { generate } from "../lib/automate/generate/generate.ts";
 import { StackBundler, type Target } from "../lib/automate/stack_bundler/stack_bundler.ts";
@@ -31,6 +31,40 @@ import { importStack, tempDir } from "../lib/automate/utils.ts";
 /** The version, updated by the build process */
 const VERSION = "0.8.0";
 
+/**
+ * The dirs the compiled wrapper may extract deno into, in the same order as
+ * cacheDirs() in cli/wrapper/cache.go.
+ */
+function wrapperCacheDirs(): string[] {
+  const dirs: string[] = [];
+  const override = Deno.env.get("CDKTS_CACHE_DIR");
+  if (override) {
+    dirs.push(override);
+  }
+
+  const home = Deno.env.get(Deno.build.os === "windows" ? "USERPROFILE" : "HOME");
+  if (Deno.build.os === "windows") {
+    const localAppData = Deno.env.get("LOCALAPPDATA");
+    if (localAppData) {
+      dirs.push(join(localAppData, "cdkts"));
+    }
+  } else {
+    // The XDG spec says relative paths are invalid and should be ignored
+    const xdgCacheHome = Deno.env.get("XDG_CACHE_HOME");
+    if (xdgCacheHome && isAbsolute(xdgCacheHome)) {
+      dirs.push(join(xdgCacheHome, "cdkts"));
+    } else if (home) {
+      dirs.push(join(home, ".cache", "cdkts"));
+    }
+  }
+
+  dirs.push(tempDir());
+  if (home) {
+    dirs.push(join(home, ".cdkts"));
+  }
+  return dirs;
+}
+
 await new Command()
   .name("cdkts")
   .version(VERSION)
@@ -454,6 +488,7 @@ await new Command()
     This command removes:
     - Temporary project directories created during command execution
     - Downloaded tofu/terraform binaries cached in the system temp directory
+    - Deno binaries extracted by the cdkts wrapper
     - Any other CDKTS-related temporary files
 
     Use this to free up disk space or reset CDKTS to a clean state.
@@ -488,15 +523,28 @@ await new Command()
     await Project.cleanUp();
 
     // Remove any cdkts-embedded- files (these are extracted from the CDKTS binary when running bundled projects)
-    const tmpDir = tempDir();
-    for await (const entry of Deno.readDir(tmpDir)) {
-      if (entry.name.startsWith("cdkts-embedded-")) {
-        const filePath = join(tmpDir, entry.name);
-        try {
-          await Deno.remove(filePath, { recursive: true });
-        } catch (error) {
-          // Ignore errors for individual file (e.g., permission issues, in-use files)
-          console.warn(`Failed to remove ${filePath}:`, error);
+    // The compiled wrapper names its extracted deno cdkts-<version>-embedded- instead, next to its published markers.
+    for (const dir of wrapperCacheDirs()) {
+      let entries;
+      try {
+        entries = await Array.fromAsync(Deno.readDir(dir));
+      } catch (e) {
+        // A dir that doesn't exist, or we can't read, has nothing of ours to clean
+        const skip = [Deno.errors.NotFound, Deno.errors.NotCapable, Deno.errors.PermissionDenied];
+        if (skip.some((type) => e instanceof type)) {
+          continue;
+        }
+        throw e;
+      }
+      for (const entry of entries) {
+        if (/^cdkts-((.+-)?embedded-|published-)/.test(entry.name)) {
+          const filePath = join(dir, entry.name);
+          try {
+            await Deno.remove(filePath, { recursive: true });
+          } catch (error) {
+            // Ignore errors for individual file (e.g., permission issues, in-use files)
+            console.warn(`Failed to remove ${filePath}:`, error);
+          }
         }
       }
     }
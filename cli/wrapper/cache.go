@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// cacheDirs returns the directories the embedded deno binary may be extracted
+// into, most preferred first. A per-user cache dir is preferred as the system
+// temp dir is often world writable and wiped on reboot. The home dir is the
+// last resort for when both of those are read only.
+func cacheDirs() []string {
+	var dirs []string
+	if dir := os.Getenv("CDKTS_CACHE_DIR"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	if dir, err := userCacheDir(); err == nil {
+		dirs = append(dirs, dir)
+	}
+	dirs = append(dirs, os.TempDir())
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".cdkts"))
+	}
+	return dirs
+}
+
+// userCacheDir resolves the cdkts cache dir without creating it.
+//
+//   - Windows: %LOCALAPPDATA%\cdkts
+//   - Everything else: $XDG_CACHE_HOME/cdkts or ~/.cache/cdkts
+func userCacheDir() (string, error) {
+	if runtime.GOOS == "windows" {
+		dir := os.Getenv("LOCALAPPDATA")
+		if dir == "" {
+			return "", errors.New("%LOCALAPPDATA% is not defined")
+		}
+		return filepath.Join(dir, "cdkts"), nil
+	}
+
+	// The XDG spec says relative paths are invalid and should be ignored
+	if dir := os.Getenv("XDG_CACHE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "cdkts"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".cache", "cdkts"), nil
+}
+
+// embeddedDenoGlob matches every file ensureEmbeddedDeno leaves in a cache
+// dir, for any release: binaries, locks & tmp files. Releases before the
+// version was added to the name used cdkts-embedded-<hash>.
+const embeddedDenoGlob = "cdkts-*embedded-*"
+
+// embeddedDenoStem returns the name, without any extension, of the binary that
+// name, a file matched by embeddedDenoGlob, belongs to.
+// eg: cdkts-0.8.0-embedded-<hash>.tmp.123 gives cdkts-0.8.0-embedded-<hash>
+func embeddedDenoStem(name string) (string, bool) {
+	prefix, rest, ok := strings.Cut(name, "embedded-")
+	if !ok || !strings.HasPrefix(prefix, "cdkts-") {
+		return "", false
+	}
+	hash, _, _ := strings.Cut(rest, ".")
+	return prefix + "embedded-" + hash, true
+}
+
+// removeStaleDenos deletes deno binaries (and their lock/tmp files) extracted
+// by other cdkts releases that have not been modified for longer than maxAge.
+// Anything belonging to keep is left alone. Errors are ignored as another
+// process may be cleaning up at the same time or still be using the file.
+func removeStaleDenos(dir, keep string, maxAge time.Duration) {
+	matches, err := filepath.Glob(filepath.Join(dir, embeddedDenoGlob))
+	if err != nil {
+		return
+	}
+
+	keepStem, _ := embeddedDenoStem(filepath.Base(keep))
+	for _, path := range matches {
+		if stem, _ := embeddedDenoStem(filepath.Base(path)); stem == keepStem {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		os.Remove(path)
+	}
+}
+
+// cleanCacheDir removes every deno binary the wrapper extracted into dir, along
+// with their lock & tmp files, returning the number of files removed and the
+// bytes freed. Each binary is removed while holding its extraction lock, so a
+// concurrent extraction is waited for rather than broken. Files that can't be
+// removed, eg: a deno that is still running on Windows, are skipped.
+func cleanCacheDir(dir string) (int, int64) {
+	matches, err := filepath.Glob(filepath.Join(dir, embeddedDenoGlob))
+	if err != nil {
+		return 0, 0
+	}
+
+	// Group the lock & tmp files with the binary they belong to
+	groups := map[string][]string{}
+	for _, path := range matches {
+		if stem, ok := embeddedDenoStem(filepath.Base(path)); ok {
+			groups[stem] = append(groups[stem], path)
+		}
+	}
+
+	removed := 0
+	freed := int64(0)
+
+	// Markers left by checkPublished need no lock
+	markers, _ := filepath.Glob(filepath.Join(dir, "cdkts-published-*"))
+	for _, path := range markers {
+		if size, ok := removeFile(path); ok {
+			removed++
+			freed += size
+		}
+	}
+
+	for stem, paths := range groups {
+		lockPath := filepath.Join(dir, stem+exeSuffix()) + ".lock"
+		lockExisted := slices.Contains(paths, lockPath)
+		// Taking the lock records us as its holder, so its size is from before
+		lockSize := int64(0)
+		if info, err := os.Stat(lockPath); err == nil {
+			lockSize = info.Size()
+		}
+		lock, err := acquireLock(lockPath, 5*time.Second)
+		if err != nil {
+			warnf("skipping %s: %v", strings.TrimSuffix(lockPath, ".lock"), err)
+			continue
+		}
+		for _, path := range paths {
+			if path == lockPath {
+				continue
+			}
+			if size, ok := removeFile(path); ok {
+				removed++
+				freed += size
+			}
+		}
+
+		// The lock file goes last, once we have let go of it. It's only
+		// counted if it was there before we took the lock.
+		releaseLock(lock)
+		if _, ok := removeFile(lockPath); ok && lockExisted {
+			removed++
+			freed += lockSize
+		}
+	}
+	return removed, freed
+}
+
+// removeFile removes the file at path, returning its size and whether it was
+// removed.
+func removeFile(path string) (int64, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	if err := os.Remove(path); err != nil {
+		debugf("unable to remove %s: %v", path, err)
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// runCleanCache removes all the wrapper's on disk state from every cache dir,
+// for recovering from corruption, and returns the exit code.
+func runCleanCache() int {
+	seen := map[string]bool{}
+	removed := 0
+	freed := int64(0)
+	for _, dir := range cacheDirs() {
+		if dir = filepath.Clean(dir); seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		n, size := cleanCacheDir(dir)
+		debugf("removed %d files (%d bytes) from %s", n, size, dir)
+		removed += n
+		freed += size
+	}
+	fmt.Printf("removed %d files, freed %.1f MB\n", removed, float64(freed)/(1<<20))
+	return 0
+}
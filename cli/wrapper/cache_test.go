@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserCacheDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Setenv("LOCALAPPDATA", `C:\Users\test\AppData\Local`)
+		got, err := userCacheDir()
+		if err != nil {
+			t.Fatalf("userCacheDir() error = %v", err)
+		}
+		if want := `C:\Users\test\AppData\Local\cdkts`; got != want {
+			t.Errorf("userCacheDir() = %q, want %q", got, want)
+		}
+		return
+	}
+
+	tests := []struct {
+		name string
+		xdg  string
+		home string
+		want string
+	}{
+		{"xdg", "/xdg/cache", "/home/test", "/xdg/cache/cdkts"},
+		{"relative xdg is ignored", "relative/cache", "/home/test", "/home/test/.cache/cdkts"},
+		{"home fallback", "", "/home/test", "/home/test/.cache/cdkts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", tt.xdg)
+			t.Setenv("HOME", tt.home)
+			got, err := userCacheDir()
+			if err != nil {
+				t.Fatalf("userCacheDir() error = %v", err)
+			}
+			if got != filepath.FromSlash(tt.want) {
+				t.Errorf("userCacheDir() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveStaleDenos(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-8 * 24 * time.Hour)
+
+	files := map[string]struct {
+		stale bool
+		kept  bool
+	}{
+		"cdkts-0.8.0-embedded-current":       {stale: true, kept: true},
+		"cdkts-0.8.0-embedded-current.lock":  {stale: true, kept: true},
+		"cdkts-embedded-current":             {stale: true, kept: false},
+		"cdkts-embedded-old":                 {stale: true, kept: false},
+		"cdkts-embedded-old.lock":            {stale: true, kept: false},
+		"cdkts-embedded-recent":              {stale: false, kept: true},
+		"cdkts-0.7.0-embedded-old":           {stale: true, kept: false},
+		"cdkts-0.8.0-embedded-current.tmp.1": {stale: true, kept: true},
+		"unrelated":                          {stale: true, kept: true},
+	}
+	for name, f := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if f.stale {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	removeStaleDenos(dir, filepath.Join(dir, "cdkts-0.8.0-embedded-current"), 7*24*time.Hour)
+
+	for name, f := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists := err == nil; exists != f.kept {
+			t.Errorf("%s exists = %v, want %v", name, exists, f.kept)
+		}
+	}
+}
+
+func TestCacheDirs(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("LOCALAPPDATA", filepath.Join(home, "AppData", "Local"))
+
+	userCache, err := userCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	homeDir := filepath.Join(home, ".cdkts")
+
+	t.Setenv("CDKTS_CACHE_DIR", "")
+	if got, want := cacheDirs(), []string{userCache, os.TempDir(), homeDir}; !slices.Equal(got, want) {
+		t.Errorf("cacheDirs() = %q, want %q", got, want)
+	}
+
+	t.Setenv("CDKTS_CACHE_DIR", "/override")
+	if got, want := cacheDirs(), []string{"/override", userCache, os.TempDir(), homeDir}; !slices.Equal(got, want) {
+		t.Errorf("cacheDirs() = %q, want %q", got, want)
+	}
+}
+
+func TestEmbeddedDenoStem(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"cdkts-0.8.0-embedded-abc", "cdkts-0.8.0-embedded-abc", true},
+		{"cdkts-0.8.0-embedded-abc.exe", "cdkts-0.8.0-embedded-abc", true},
+		{"cdkts-0.8.0-embedded-abc.exe.lock", "cdkts-0.8.0-embedded-abc", true},
+		{"cdkts-1.0.0-rc.1-embedded-abc.tmp.123.exe", "cdkts-1.0.0-rc.1-embedded-abc", true},
+		{"cdkts-embedded-abc.lock", "cdkts-embedded-abc", true},
+		{"cdkts-1.2.3-e3b0c44298fc.lock", "", false},
+		{"other-embedded-abc", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := embeddedDenoStem(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("embeddedDenoStem(%q) = %q, %t, want %q, %t", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCleanCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	hash := strings.Repeat("a", 64)
+	deno := "cdkts-embedded-" + hash + exeSuffix()
+	files := map[string]bool{
+		deno:                                  false,
+		deno + ".lock":                        false,
+		"cdkts-embedded-" + hash + ".tmp.123": false,
+		"cdkts-embedded-" + strings.Repeat("b", 64) + exeSuffix(): false,
+		"cdkts-0.8.0-embedded-" + hash + exeSuffix():              false,
+		"cdkts-0.8.0-embedded-" + hash + ".tmp.456":               false,
+		"cdkts-published-0123456789abcdef":                        false,
+		"unrelated":                                               true,
+		"cdkts-1.2.3-e3b0c44298fc.lock":                           true,
+	}
+	for name := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("deno"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, freed := cleanCacheDir(dir)
+	if removed != 7 || freed != 28 {
+		t.Errorf("cleanCacheDir() = %d, %d, want 7, 28", removed, freed)
+	}
+	for name, kept := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if exists := err == nil; exists != kept {
+			t.Errorf("%s exists = %v, want %v", name, exists, kept)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("cleanCacheDir() left %d files, want 2", len(entries))
+	}
+}
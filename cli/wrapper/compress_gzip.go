@@ -0,0 +1,26 @@
+//go:build !zstd
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"errors"
+	"io"
+)
+
+//go:embed deno.gz
+var denoCompressedBytes []byte
+
+// newDenoReader returns a reader that decompresses the embedded deno binary.
+func newDenoReader(data []byte) (io.ReadCloser, error) {
+	return gzip.NewReader(bytes.NewReader(data))
+}
+
+// isCorruptStream reports whether an error reading from newDenoReader means
+// the embedded data itself is bad. The gzip reader only validates the CRC &
+// length at EOF, so those are the errors that point at a broken build.
+func isCorruptStream(err error) bool {
+	return errors.Is(err, gzip.ErrChecksum) || errors.Is(err, io.ErrUnexpectedEOF)
+}
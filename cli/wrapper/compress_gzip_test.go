@@ -0,0 +1,36 @@
+//go:build !zstd
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+// compressDeno compresses data the same way the build script does.
+func compressDeno(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// corruptDenos returns embeds that are broken in the ways a bad build might be.
+func corruptDenos(t *testing.T) map[string][]byte {
+	valid := compressDeno(t, bytes.Repeat([]byte("deno"), 1024))
+
+	badCRC := bytes.Clone(valid)
+	badCRC[len(badCRC)-8] ^= 0xff
+
+	return map[string][]byte{
+		"bad crc":   badCRC,
+		"truncated": valid[:len(valid)-4],
+		"not gzip":  []byte("definitely not gzip"),
+	}
+}
@@ -0,0 +1,46 @@
+//go:build zstd
+
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Builds tagged zstd embed deno.zst instead of deno.gz, which compresses deno
+// much better at the cost of a third party decoder.
+//
+//go:embed deno.zst
+var denoCompressedBytes []byte
+
+// newDenoReader returns a reader that decompresses the embedded deno binary.
+func newDenoReader(data []byte) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+// isCorruptStream reports whether an error reading from newDenoReader means
+// the embedded data itself is bad rather than, say, the disk being full.
+func isCorruptStream(err error) bool {
+	for _, corrupt := range []error{
+		zstd.ErrCRCMismatch,
+		zstd.ErrMagicMismatch,
+		zstd.ErrReservedBlockType,
+		zstd.ErrBlockTooSmall,
+		zstd.ErrUnexpectedBlockSize,
+		zstd.ErrFrameSizeMismatch,
+		io.ErrUnexpectedEOF,
+	} {
+		if errors.Is(err, corrupt) {
+			return true
+		}
+	}
+	return false
+}
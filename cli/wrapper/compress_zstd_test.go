@@ -0,0 +1,35 @@
+//go:build zstd
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressDeno compresses data the same way the build script does.
+func compressDeno(t *testing.T, data []byte) []byte {
+	t.Helper()
+	w, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithEncoderCRC(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	return w.EncodeAll(data, nil)
+}
+
+// corruptDenos returns embeds that are broken in the ways a bad build might be.
+func corruptDenos(t *testing.T) map[string][]byte {
+	valid := compressDeno(t, bytes.Repeat([]byte("deno"), 1024))
+
+	badCRC := bytes.Clone(valid)
+	badCRC[len(badCRC)-1] ^= 0xff
+
+	return map[string][]byte{
+		"bad crc":   badCRC,
+		"truncated": valid[:len(valid)-8],
+		"not zstd":  []byte("definitely not zstd"),
+	}
+}
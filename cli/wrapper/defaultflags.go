@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// cliCommand returns the index in args of the CLI command, eg: apply, the
+// first argument that isn't a flag, or -1 if there isn't one.
+func cliCommand(args []string) int {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			return i
+		}
+	}
+	return -1
+}
+
+// defaultFlagsEnv is the environment variable holding the default flags for
+// command, eg: CDKTS_DEFAULT_FLAGS_APPLY.
+func defaultFlagsEnv(command string) string {
+	return "CDKTS_DEFAULT_FLAGS_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, command)
+}
+
+// flagName is the name of a flag without any attached value, eg: -out=x gives -out.
+func flagName(flag string) string {
+	name, _, _ := strings.Cut(flag, "=")
+	return name
+}
+
+// hasFlag reports whether args already contain a flag with the same name.
+func hasFlag(args []string, flag string) bool {
+	return slices.ContainsFunc(args, func(arg string) bool {
+		return flagName(arg) == flagName(flag)
+	})
+}
+
+// withDefaultFlags injects the flags from CDKTS_DEFAULT_FLAGS_<COMMAND> into
+// args for the command being run, eg: CDKTS_DEFAULT_FLAGS_APPLY="-- -auto-approve".
+// Flags before a "--" are for the CLI and go right after the command, those
+// after it are passed through to tofu/terraform. A flag the user already gave
+// is never added again.
+//
+// Like CDKTS_DENO_FLAGS every token must be a flag with any value attached
+// with "=", otherwise we couldn't tell whether the user already gave it.
+func withDefaultFlags(args []string) ([]string, error) {
+	i := cliCommand(args)
+	if i < 0 {
+		return args, nil
+	}
+	name := defaultFlagsEnv(args[i])
+	defaults, err := shellSplit(os.Getenv(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	if len(defaults) == 0 {
+		return args, nil
+	}
+
+	cliDefaults, passDefaults := defaults, []string(nil)
+	if sep := slices.Index(defaults, "--"); sep >= 0 {
+		cliDefaults, passDefaults = defaults[:sep], defaults[sep+1:]
+	}
+	for _, flag := range slices.Concat(cliDefaults, passDefaults) {
+		if !strings.HasPrefix(flag, "-") {
+			return nil, fmt.Errorf("%s may only contain flags, got %q", name, flag)
+		}
+	}
+
+	userArgs, passArgs := args, []string(nil)
+	if sep := slices.Index(args, "--"); sep >= 0 {
+		userArgs, passArgs = args[:sep], args[sep+1:]
+	}
+
+	result := slices.Clone(args[:i+1])
+	for _, flag := range cliDefaults {
+		if !hasFlag(userArgs, flag) {
+			result = append(result, flag)
+		}
+	}
+	result = append(result, userArgs[i+1:]...)
+
+	var pass []string
+	for _, flag := range passDefaults {
+		if !hasFlag(passArgs, flag) {
+			pass = append(pass, flag)
+		}
+	}
+	if len(pass) > 0 || passArgs != nil {
+		result = append(result, "--")
+		result = append(result, pass...)
+		result = append(result, passArgs...)
+	}
+	if len(result) != len(args) {
+		debugf("added default flags from %s: %q", name, result)
+	}
+	return result, nil
+}
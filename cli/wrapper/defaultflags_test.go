@@ -0,0 +1,100 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDefaultFlagsEnv(t *testing.T) {
+	tests := map[string]string{
+		"apply":   "CDKTS_DEFAULT_FLAGS_APPLY",
+		"Plan":    "CDKTS_DEFAULT_FLAGS_PLAN",
+		"state-x": "CDKTS_DEFAULT_FLAGS_STATE_X",
+	}
+	for command, want := range tests {
+		if got := defaultFlagsEnv(command); got != want {
+			t.Errorf("defaultFlagsEnv(%q) = %q, want %q", command, got, want)
+		}
+	}
+}
+
+func TestWithDefaultFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		apply   string
+		plan    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "pass through",
+			apply: "-- -auto-approve",
+			args:  []string{"apply", "stack.ts"},
+			want:  []string{"apply", "stack.ts", "--", "-auto-approve"},
+		},
+		{
+			name:  "appended to existing pass through",
+			apply: "-- -auto-approve",
+			args:  []string{"apply", "stack.ts", "--", "-parallelism=10"},
+			want:  []string{"apply", "stack.ts", "--", "-auto-approve", "-parallelism=10"},
+		},
+		{
+			name:  "cli flags go after the command",
+			apply: "--destroy",
+			args:  []string{"--clean", "apply", "stack.ts"},
+			want:  []string{"--clean", "apply", "--destroy", "stack.ts"},
+		},
+		{
+			name:  "not duplicated",
+			apply: "--destroy -- -auto-approve -parallelism=5",
+			args:  []string{"apply", "--destroy", "stack.ts", "--", "-parallelism=10"},
+			want:  []string{"apply", "--destroy", "stack.ts", "--", "-auto-approve", "-parallelism=10"},
+		},
+		{
+			name:  "other command",
+			apply: "-- -auto-approve",
+			plan:  "-- -out=tfplan",
+			args:  []string{"plan", "stack.ts"},
+			want:  []string{"plan", "stack.ts", "--", "-out=tfplan"},
+		},
+		{
+			name:  "no command",
+			apply: "-- -auto-approve",
+			args:  []string{"--help"},
+			want:  []string{"--help"},
+		},
+		{
+			name:  "apply after -- is not the command",
+			apply: "-- -auto-approve",
+			args:  []string{"--", "apply"},
+			want:  []string{"--", "apply"},
+		},
+		{
+			name:    "not a flag",
+			apply:   "-- -out tfplan",
+			args:    []string{"apply", "stack.ts"},
+			wantErr: true,
+		},
+		{
+			name:    "bad quoting",
+			apply:   `"-- -auto-approve`,
+			args:    []string{"apply", "stack.ts"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CDKTS_DEFAULT_FLAGS_APPLY", tt.apply)
+			t.Setenv("CDKTS_DEFAULT_FLAGS_PLAN", tt.plan)
+
+			got, err := withDefaultFlags(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("withDefaultFlags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("withDefaultFlags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// doctorCheck is a single, independently reported, check run by wrapper-doctor.
+type doctorCheck struct {
+	name     string
+	critical bool
+	run      func() (string, error)
+}
+
+var doctorChecks = []doctorCheck{
+	{"deno", true, checkDoctorDeno},
+	{"cache dir", true, checkDoctorCacheDir},
+	{"jsr.io", true, checkDoctorNetwork},
+	{"tofu/terraform", false, checkDoctorTf},
+}
+
+// runDoctor runs every check, prints a summary and returns the exit code,
+// which is non zero if any critical check failed.
+func runDoctor() int {
+	code := 0
+	color := colorEnabled(os.Stdout)
+	for _, check := range doctorChecks {
+		detail, err := check.run()
+		switch {
+		case err == nil:
+			fmt.Printf("%s %s: %s\n", colorize(color, ansiGreen, "✔"), check.name, detail)
+		case check.critical:
+			fmt.Printf("%s %s: %v\n", colorize(color, ansiRed, "✘"), check.name, err)
+			code = 1
+		default:
+			fmt.Printf("%s %s: %v\n", colorize(color, ansiYellow, "!"), check.name, err)
+		}
+	}
+	return code
+}
+
+func checkDoctorDeno() (string, error) {
+	denoPath := os.Getenv("CDKTS_DENO_PATH")
+	if denoPath == "" {
+		if err := checkEmbeddedDeno(); err != nil {
+			return "", err
+		}
+		var err error
+		if denoPath, _, err = ensureEmbeddedDeno(); err != nil {
+			return "", err
+		}
+	}
+
+	out, err := exec.Command(denoPath, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run %s: %w", denoPath, err)
+	}
+	version, _, _ := strings.Cut(string(out), "\n")
+	return fmt.Sprintf("%s (%s)", version, denoPath), nil
+}
+
+// checkDoctorCacheDir reports the cache dir deno is actually extracted into,
+// which is only a problem if none of cacheDirs can be used.
+func checkDoctorCacheDir() (string, error) {
+	if err := checkEmbeddedDeno(); err != nil {
+		return "", err
+	}
+	denoPath, _, err := ensureEmbeddedDeno()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(denoPath)
+	if preferred := cacheDirs()[0]; dir != preferred {
+		return fmt.Sprintf("using %s, %s is unusable", dir, preferred), nil
+	}
+	return "using " + dir, nil
+}
+
+// checkDoctorNetwork makes sure deno can connect to the registry, or to the
+// proxy it has to go through instead.
+func checkDoctorNetwork() (string, error) {
+	base, err := registryBase()
+	if err != nil {
+		return "", err
+	}
+	applyProxyEnv()
+	if proxy, ok := proxyURL(); ok {
+		if !hostReachable(proxy, 5*time.Second) {
+			return "", fmt.Errorf("unable to reach the proxy %s, check your proxy settings", proxy.Host)
+		}
+		return "proxy " + proxy.Host + " is reachable", nil
+	}
+	if !registryReachable(base, 5*time.Second) {
+		return "", fmt.Errorf("unable to reach %s, check your network or proxy settings", base)
+	}
+	return "reachable", nil
+}
+
+func checkDoctorTf() (string, error) {
+	if path := os.Getenv("CDKTS_TF_BINARY_PATH"); path != "" {
+		if err := checkExecutable(path); err != nil {
+			return "", fmt.Errorf("CDKTS_TF_BINARY_PATH is invalid: %w", err)
+		}
+		return path, nil
+	}
+	for _, name := range []string{"tofu", "terraform"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("not found on PATH, the CLI will download it on demand")
+}
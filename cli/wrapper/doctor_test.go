@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunDoctor(t *testing.T) {
+	original := doctorChecks
+	t.Cleanup(func() { doctorChecks = original })
+
+	pass := func() (string, error) { return "ok", nil }
+	fail := func() (string, error) { return "", errors.New("broken") }
+
+	tests := []struct {
+		name   string
+		checks []doctorCheck
+		want   int
+	}{
+		{"all pass", []doctorCheck{{"a", true, pass}, {"b", false, pass}}, 0},
+		{"non critical failure", []doctorCheck{{"a", true, pass}, {"b", false, fail}}, 0},
+		{"critical failure", []doctorCheck{{"a", true, fail}, {"b", false, pass}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doctorChecks = tt.checks
+			if got := runDoctor(); got != tt.want {
+				t.Errorf("runDoctor() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDoctorNetworkProxy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	for _, name := range []string{"CDKTS_PROXY", "HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy", "CDKTS_REGISTRY_BASE"} {
+		t.Setenv(name, "")
+	}
+
+	t.Run("reachable", func(t *testing.T) {
+		t.Setenv("CDKTS_PROXY", "http://"+ln.Addr().String())
+		t.Setenv("HTTPS_PROXY", "")
+		detail, err := checkDoctorNetwork()
+		if err != nil {
+			t.Fatalf("checkDoctorNetwork() error = %v", err)
+		}
+		if !strings.Contains(detail, ln.Addr().String()) {
+			t.Errorf("checkDoctorNetwork() = %q, want it to name the proxy", detail)
+		}
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		t.Setenv("HTTPS_PROXY", closed.Addr().String())
+		if _, err := checkDoctorNetwork(); err == nil || !strings.Contains(err.Error(), "proxy") {
+			t.Errorf("checkDoctorNetwork() error = %v, want a proxy error", err)
+		}
+	})
+}
+
+func TestCheckDoctorCacheDirFallback(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("LOCALAPPDATA", os.Getenv("XDG_CACHE_HOME"))
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CDKTS_CACHE_DIR", filepath.Join(file, "cache"))
+
+	detail, err := checkDoctorCacheDir()
+	if err != nil {
+		t.Fatalf("checkDoctorCacheDir() error = %v", err)
+	}
+	if want := "using " + cacheDirs()[1]; !strings.HasPrefix(detail, want) {
+		t.Errorf("checkDoctorCacheDir() = %q, want it to start with %q", detail, want)
+	}
+}
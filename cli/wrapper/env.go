@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+// envBool reports whether the environment variable name is set to a truthy
+// value, as understood by strconv.ParseBool (eg: 1, true, TRUE).
+func envBool(name string) bool {
+	value, err := strconv.ParseBool(os.Getenv(name))
+	return err == nil && value
+}
+
+// applyDenoDirEnv exports CDKTS_DENO_DIR as DENO_DIR, where deno caches the
+// modules it downloads, creating it if need be. A DENO_DIR the user has
+// already set is left alone.
+func applyDenoDirEnv() error {
+	dir := os.Getenv("CDKTS_DENO_DIR")
+	if dir == "" || os.Getenv("DENO_DIR") != "" {
+		return nil
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve CDKTS_DENO_DIR: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create CDKTS_DENO_DIR: %w", err)
+	}
+	return os.Setenv("DENO_DIR", dir)
+}
+
+// wrapperEnv is a snapshot of what the wrapper resolved, for bug reports.
+type wrapperEnv struct {
+	WrapperVersion string `json:"wrapperVersion"`
+	CliVersion     string `json:"cliVersion"`
+	CliSpecifier   string `json:"cliSpecifier"`
+	DenoVersion    string `json:"denoVersion"`
+	DenoPath       string `json:"denoPath"`
+	DenoExtracted  bool   `json:"denoExtracted"`
+	CacheDir       string `json:"cacheDir,omitempty"`
+	OS             string `json:"os"`
+	Arch           string `json:"arch"`
+}
+
+// newWrapperEnv collects the wrapperEnv for the deno binary at denoPath.
+func newWrapperEnv(denoPath string, extracted bool) (*wrapperEnv, error) {
+	version, err := cliVersion()
+	if err != nil {
+		return nil, err
+	}
+	specifier, err := cliSpecifier()
+	if err != nil {
+		return nil, err
+	}
+	env := &wrapperEnv{
+		WrapperVersion: cdkTsVersion,
+		CliVersion:     version,
+		CliSpecifier:   specifier,
+		DenoVersion:    embeddedDenoVersion(),
+		DenoPath:       denoPath,
+		DenoExtracted:  extracted,
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+	}
+	if _, ok := embeddedDenoStem(filepath.Base(denoPath)); ok {
+		env.CacheDir = filepath.Dir(denoPath)
+	}
+	return env, nil
+}
+
+// printWrapperEnv writes env to stdout, as JSON when asJSON is set so that
+// scripts can capture it, otherwise as one "key: value" per line.
+func printWrapperEnv(env *wrapperEnv, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(env)
+	}
+	fmt.Printf("wrapperVersion: %s\n", env.WrapperVersion)
+	fmt.Printf("cliVersion:     %s\n", env.CliVersion)
+	fmt.Printf("cliSpecifier:   %s\n", env.CliSpecifier)
+	fmt.Printf("denoVersion:    %s\n", env.DenoVersion)
+	fmt.Printf("denoPath:       %s\n", env.DenoPath)
+	fmt.Printf("denoExtracted:  %t\n", env.DenoExtracted)
+	fmt.Printf("cacheDir:       %s\n", env.CacheDir)
+	fmt.Printf("os:             %s\n", env.OS)
+	fmt.Printf("arch:           %s\n", env.Arch)
+	return nil
+}
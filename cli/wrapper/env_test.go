@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestNewWrapperEnv(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name         string
+		denoPath     string
+		wantCacheDir string
+	}{
+		{"embedded", embeddedDenoPath(dir), dir},
+		{"external", filepath.Join(dir, "deno"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CDKTS_VERSION", "1.2.3")
+			t.Setenv("CDKTS_LOCAL_MAIN", "")
+			env, err := newWrapperEnv(tt.denoPath, false)
+			if err != nil {
+				t.Fatalf("newWrapperEnv() error = %v", err)
+			}
+			if env.CacheDir != tt.wantCacheDir {
+				t.Errorf("CacheDir = %q, want %q", env.CacheDir, tt.wantCacheDir)
+			}
+			if env.CliVersion != "1.2.3" || env.CliSpecifier != "jsr:@brad-jones/cdkts@1.2.3/cli" {
+				t.Errorf("CliVersion = %q, CliSpecifier = %q", env.CliVersion, env.CliSpecifier)
+			}
+			if env.OS != runtime.GOOS || env.Arch != runtime.GOARCH {
+				t.Errorf("OS = %q, Arch = %q", env.OS, env.Arch)
+			}
+		})
+	}
+}
+
+func TestApplyDenoDirEnv(t *testing.T) {
+	t.Run("exported to the child", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "deno", "cache")
+		t.Setenv("CDKTS_DENO_DIR", dir)
+		t.Setenv("DENO_DIR", "")
+		if err := applyDenoDirEnv(); err != nil {
+			t.Fatalf("applyDenoDirEnv() error = %v", err)
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			t.Errorf("applyDenoDirEnv() did not create %s", dir)
+		}
+
+		// runBinary is how deno is always run on Windows
+		t.Setenv("GO_WANT_HELPER_PROCESS", "1")
+		t.Setenv("HELPER_ENV_NAME", "DENO_DIR")
+		t.Setenv("HELPER_ENV_VALUE", dir)
+		code, err := runBinary(os.Args[0], []string{"-test.run=TestHelperProcess"}, 0)
+		if err != nil || code != 0 {
+			t.Errorf("runBinary() = %d, %v, the child did not see DENO_DIR", code, err)
+		}
+	})
+
+	t.Run("existing DENO_DIR wins", func(t *testing.T) {
+		t.Setenv("CDKTS_DENO_DIR", filepath.Join(t.TempDir(), "ignored"))
+		t.Setenv("DENO_DIR", "/existing")
+		if err := applyDenoDirEnv(); err != nil {
+			t.Fatalf("applyDenoDirEnv() error = %v", err)
+		}
+		if got := os.Getenv("DENO_DIR"); got != "/existing" {
+			t.Errorf("DENO_DIR = %q, want /existing", got)
+		}
+	})
+}
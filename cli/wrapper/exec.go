@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// execError is returned when deno could not be run at all, as opposed to
+// running and exiting non zero.
+type execError struct {
+	path string
+	args []string
+	err  error
+}
+
+func (e *execError) Error() string {
+	return fmt.Sprintf("failed to run %s: %v", shellJoin(append([]string{e.path}, redactArgs(e.args)...)), e.err)
+}
+
+func (e *execError) Unwrap() error {
+	return e.err
+}
+
+// redactArgs summarizes args for error messages. Everything after a "--"
+// separator is passed through to tofu/terraform and may well contain secrets
+// (eg: -var=password=...), so only the count of those args is kept.
+func redactArgs(args []string) []string {
+	i := slices.Index(args, "--")
+	if i == -1 || i == len(args)-1 {
+		return args
+	}
+	return append(slices.Clip(args[:i+1]), fmt.Sprintf("<%d args redacted>", len(args)-i-1))
+}
+
+// isQuarantined reports whether err means deno could not be started because
+// the binary went missing, or became unreadable, since it was extracted. On
+// Windows this is usually antivirus quarantining the freshly written exe.
+func isQuarantined(err error) bool {
+	var execErr *execError
+	return errors.As(err, &execErr) && (errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission))
+}
+
+// retryQuarantined calls launch and, if deno was quarantined, calls reextract
+// and then launch once more, which self heals the common case of antivirus
+// removing the binary just the once. reextract is nil when deno isn't ours,
+// eg: the system deno, which is then never touched.
+func retryQuarantined(launch func() (int, error), reextract func() error) (int, error) {
+	code, err := launch()
+	if reextract == nil || !isQuarantined(err) {
+		return code, err
+	}
+	warnf("deno could not be started, extracting it again: %v", err)
+	if reErr := reextract(); reErr != nil {
+		debugf("unable to extract deno again: %v", reErr)
+		return code, err
+	}
+	return launch()
+}
+
+// exitCode maps the error returned from running a child process to the code
+// the wrapper should exit with. A non zero exit of the child is not an error,
+// its code is passed through as is, and a child killed by a signal maps to
+// 128+n, like a shell would report it. Any other error means the child could
+// not be run at all.
+func exitCode(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	return 1, err
+}
+
+// execArgv builds the argv for deno. argv[0] is set to the name the wrapper was
+// invoked as, rather than the path to the extracted deno binary, so that
+// process listings and crash reports show "cdkts" instead of a cache path.
+// Deno resolves its own executable via the OS, not argv[0], so is unaffected.
+func execArgv(args []string) []string {
+	return append([]string{filepath.Base(os.Args[0])}, args...)
+}
+
+// exitTimeout is the exit code used when CDKTS_TIMEOUT expires, the same as
+// coreutils timeout so CI scripts can tell it apart from a failed stack.
+const exitTimeout = 124
+
+// errTimeout is returned by runBinary when the timeout expired.
+var errTimeout = errors.New("timed out")
+
+// childTimeout parses CDKTS_TIMEOUT, a Go duration such as 30m, returning 0
+// when it's unset.
+func childTimeout() (time.Duration, error) {
+	return durationEnv("CDKTS_TIMEOUT")
+}
+
+// durationEnv parses the environment variable name, a positive Go duration,
+// returning 0 when it's unset.
+func durationEnv(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("%s %q is not a positive duration, eg: 30m", name, value)
+	}
+	return timeout, nil
+}
+
+// maxCommandLine is the most UTF-16 code units a Windows command line can hold,
+// including the terminating null.
+const maxCommandLine = 32767
+
+// checkCommandLine reports a clear error for an argv that's too long for
+// Windows, which otherwise fails to start the process with a vague error.
+// Deno has no response file support for us to fall back to.
+func checkCommandLine(argv []string) error {
+	length := windowsCommandLineLength(argv)
+	if length >= maxCommandLine {
+		return fmt.Errorf("the deno command line is %d characters long, over the Windows limit of %d, pass fewer or shorter args, eg: move -var flags into a .tfvars file", length, maxCommandLine-1)
+	}
+	return nil
+}
+
+// launchDeno runs deno, by default replacing the wrapper with it, see
+// execBinary, which costs nothing. Anything that needs the wrapper to outlive
+// deno, eg: a timeout or cleaning up after CDKTS_NO_CACHE, runs it as a child
+// instead, see runBinary. CDKTS_SUPERVISE asks for that regardless.
+func launchDeno(denoPath string, args []string, supervise bool, timeout time.Duration) (int, error) {
+	if supervise || envBool("CDKTS_SUPERVISE") || timeout > 0 || envBool("CDKTS_FORCE_TTY") || os.Getenv("CDKTS_LOG_FILE") != "" || os.Getenv("CDKTS_POST_RUN") != "" {
+		return runBinary(denoPath, args, timeout)
+	}
+	return execBinary(denoPath, args)
+}
+
+// runBinary runs the binary at the given path as a child process, relaying
+// signals to it, and returns its exit code once it has finished. Unlike
+// execBinary this always returns, which allows for cleanup after deno exits.
+//
+// If timeout is non zero the child, and everything it started, is killed once
+// it expires and exitTimeout is returned along with errTimeout.
+func runBinary(binaryPath string, args []string, timeout time.Duration) (int, error) {
+	if runtime.GOOS == "windows" {
+		if err := checkCommandLine(execArgv(args)); err != nil {
+			return 1, err
+		}
+	}
+
+	logFile, err := openLogFile()
+	if err != nil {
+		return 1, err
+	}
+	if logFile != nil {
+		defer closeLogFile(logFile)
+	}
+
+	// Copying the output to CDKTS_LOG_FILE means it goes through pipes, or the
+	// pseudo terminal, rather than straight to ours
+	cmd := exec.Command(binaryPath, args...)
+	cmd.Args = execArgv(args)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout, cmd.Stderr = teeOutput(logFile)
+
+	var pty *ptyOutput
+	if envBool("CDKTS_FORCE_TTY") {
+		if pty, err = attachPty(cmd, cmd.Stdout); err != nil {
+			warnf("unable to allocate a pseudo terminal for CDKTS_FORCE_TTY: %v", err)
+		}
+	}
+
+	// A process tree can only be killed as a whole if it's in its own group
+	isolated := timeout > 0
+	defer configureChild(cmd, isolated)()
+
+	err = cmd.Start()
+	if pty != nil {
+		pty.started()
+		defer pty.wait()
+	}
+	if err != nil {
+		return 1, &execError{binaryPath, args, err}
+	}
+
+	code, timedOut, err := waitChild(cmd, isolated, timeout)
+	if timedOut {
+		return exitTimeout, fmt.Errorf("%w: deno was killed after running for longer than CDKTS_TIMEOUT (%s)", errTimeout, timeout)
+	}
+	if err != nil {
+		return code, &execError{binaryPath, args, err}
+	}
+	return code, nil
+}
+
+// waitChild waits for cmd, which must have been started, to exit, relaying
+// signals to it in the meantime, and returns its exit code. If timeout is non
+// zero the child, and everything it started, is killed once it expires, which
+// requires it to be isolated, and timedOut is set.
+func waitChild(cmd *exec.Cmd, isolated bool, timeout time.Duration) (code int, timedOut bool, err error) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			forwardSignal(cmd, sig, isolated)
+		}
+	}()
+
+	var expired atomic.Bool
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			expired.Store(true)
+			killProcessTree(cmd)
+		})
+		defer timer.Stop()
+	}
+
+	code, err = exitCode(cmd.Wait())
+	return code, expired.Load(), err
+}
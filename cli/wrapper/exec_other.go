@@ -0,0 +1,91 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// errExecFormat is returned when the binary was built for another architecture.
+var errExecFormat error = syscall.ENOEXEC
+
+// execBinary executes the binary at the given path with the provided arguments.
+// On Unix systems, it uses syscall.Exec to replace the current process, so
+// signals and the exit code flow to and from deno without any help from us.
+// It only ever returns if the exec itself failed.
+func execBinary(binaryPath string, args []string) (int, error) {
+	// Any hint or debug output we printed must not die with this process
+	flushOutput()
+	if err := syscall.Exec(binaryPath, execArgv(args), os.Environ()); err != nil {
+		return 1, &execError{binaryPath, args, err}
+	}
+	return 0, nil
+}
+
+// The child shares our process group, so an interactive Ctrl+C already reaches
+// it straight from the terminal. We catch SIGINT only so that we outlive the
+// child, relaying it as well would deliver it twice, which terraform treats as
+// a request to stop immediately. Everything else is relayed as is.
+//
+// An isolated child is in its own process group, which the terminal doesn't
+// signal, so there everything including SIGINT is relayed to the whole group.
+var forwardedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+// A group that isn't the terminal's foreground group is stopped with SIGTTIN
+// as soon as it reads from the terminal, eg: tofu asking for approval. So an
+// isolated child is handed the terminal, if we have it, and the returned func
+// takes it back once the child has exited.
+func configureChild(cmd *exec.Cmd, isolated bool) func() {
+	if !isolated {
+		return func() {}
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if !ownsTerminal(os.Stdin) {
+		return func() {}
+	}
+	cmd.SysProcAttr.Foreground = true
+	cmd.SysProcAttr.Ctty = int(os.Stdin.Fd())
+	return func() { reclaimTerminal(os.Stdin) }
+}
+
+// ownsTerminal reports whether f is a terminal our process group is in the
+// foreground of.
+func ownsTerminal(f *os.File) bool {
+	var pgrp int32
+	return ioctl(f, syscall.TIOCGPGRP, unsafe.Pointer(&pgrp)) == nil && int(pgrp) == syscall.Getpgrp()
+}
+
+// reclaimTerminal makes our process group the foreground group of the
+// terminal f again. Doing so from the background raises SIGTTOU, which would
+// stop us, unless it's ignored.
+func reclaimTerminal(f *os.File) {
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	pgrp := int32(syscall.Getpgrp())
+	ioctl(f, syscall.TIOCSPGRP, unsafe.Pointer(&pgrp))
+}
+
+func ioctl(f *os.File, req uint, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(req), uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func forwardSignal(cmd *exec.Cmd, sig os.Signal, isolated bool) {
+	switch {
+	case isolated:
+		syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+	case sig != os.Interrupt:
+		cmd.Process.Signal(sig)
+	}
+}
+
+// killProcessTree kills an isolated child along with everything it started.
+func killProcessTree(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,118 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"testing"
+)
+
+// runInTerminal runs cmd with a pseudo terminal as its controlling terminal,
+// like it would have when run from a shell, and answers "yes" to the prompt
+// it's expected to show.
+func runInTerminal(t *testing.T, cmd *exec.Cmd) int {
+	t.Helper()
+	master, slave, err := openPty()
+	if err != nil {
+		t.Skipf("unable to allocate a pseudo terminal: %v", err)
+	}
+	defer master.Close()
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	slave.Close()
+	if _, err := master.Write([]byte("yes\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := exitCode(cmd.Wait())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestRunBinaryTimeoutInteractive(t *testing.T) {
+	cmd := helperCommand(t, 0)
+	cmd.Env = append(cmd.Env, "HELPER_LAUNCH=1", "HELPER_READ=1", "CDKTS_TIMEOUT=10s", "CDKTS_SUPERVISE=", "CDKTS_FORCE_TTY=", "CDKTS_LOG_FILE=", "CDKTS_POST_RUN=")
+	if code := runInTerminal(t, cmd); code != 0 {
+		t.Errorf("exit code = %d, want 0", code)
+	}
+}
+
+// TestHookHelperProcess isn't a real test, it stands in for the wrapper
+// running CDKTS_PRE_RUN, which must leave it in charge of the terminal.
+func TestHookHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HOOK_HELPER_PROCESS") != "1" {
+		return
+	}
+	code, _ := runHook("CDKTS_PRE_RUN")
+	if code == 0 && !ownsTerminal(os.Stdin) {
+		code = 95
+	}
+	os.Exit(code)
+}
+
+func TestRunHookInteractive(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=TestHookHelperProcess")
+	cmd.Env = append(os.Environ(), "GO_WANT_HOOK_HELPER_PROCESS=1", "GO_WANT_HELPER_PROCESS=1", "HELPER_READ=1", "CDKTS_PRE_RUN_TIMEOUT=10s", "CDKTS_PRE_RUN="+shellJoin([]string{os.Args[0], "-test.run=TestHelperProcess"}))
+	if code := runInTerminal(t, cmd); code != 0 {
+		t.Errorf("exit code = %d, want 0", code)
+	}
+}
+
+func TestRunBinarySignaled(t *testing.T) {
+	t.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	t.Setenv("HELPER_PRINT_PID", "1")
+	t.Setenv("HELPER_SLEEP", "1m")
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	original := os.Stdout
+	os.Stdout = w
+	t.Cleanup(func() { os.Stdout = original })
+
+	type result struct {
+		code int
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		code, err := runBinary(os.Args[0], []string{"-test.run=TestHelperProcess"}, 0)
+		done <- result{code, err}
+	}()
+
+	var pid int
+	if _, err := fmt.Fscanln(r, &pid); err != nil {
+		t.Fatalf("failed to read the child's PID: %v", err)
+	}
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	got := <-done
+	w.Close()
+	if got.err != nil || got.code != 143 {
+		t.Fatalf("runBinary() = %d, %v, want 143, nil", got.code, got.err)
+	}
+
+	// The hook exits 99 unless it's given the same exit code
+	t.Setenv("HELPER_PRINT_PID", "")
+	t.Setenv("HELPER_SLEEP", "")
+	t.Setenv("HELPER_ENV_NAME", "CDKTS_EXIT_CODE")
+	t.Setenv("HELPER_ENV_VALUE", "143")
+	t.Setenv("CDKTS_POST_RUN", shellJoin([]string{os.Args[0], "-test.run=TestHelperProcess"}))
+	t.Setenv("CDKTS_POST_RUN_TIMEOUT", "")
+	stderr := captureOutput(t, &os.Stderr)
+	if code := runPostRun(got.code); code != 143 || len(stderr()) > 0 {
+		t.Errorf("runPostRun(143) = %d, wrote %q, want 143 and no warning", code, stderr())
+	}
+}
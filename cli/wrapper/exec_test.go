@@ -0,0 +1,374 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHelperProcess isn't a real test, it's used as a stand in for deno by
+// tests that need a child process.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	if name := os.Getenv("HELPER_ENV_NAME"); name != "" && os.Getenv(name) != os.Getenv("HELPER_ENV_VALUE") {
+		os.Exit(99)
+	}
+	if os.Getenv("HELPER_WANT_TTY") == "1" && (!isTerminal(os.Stdout) || !isTerminal(os.Stderr)) {
+		os.Exit(98)
+	}
+	if os.Getenv("HELPER_WANT_TTY") == "1" || os.Getenv("HELPER_OUTPUT") == "1" {
+		fmt.Println("line 1")
+		fmt.Fprintln(os.Stderr, "line 2")
+	}
+	if os.Getenv("HELPER_LAUNCH") == "1" {
+		// Stand in for the wrapper, launching another helper as deno
+		os.Setenv("HELPER_LAUNCH", "")
+		timeout, _ := childTimeout()
+		code, err := launchDeno(os.Args[0], []string{"-test.run=TestHelperProcess"}, false, timeout)
+		if err != nil {
+			os.Exit(97)
+		}
+		os.Exit(code)
+	}
+	if os.Getenv("HELPER_READ") == "1" {
+		// Stand in for a prompt, eg: tofu asking for approval
+		var answer string
+		if _, err := fmt.Scanln(&answer); err != nil || answer != "yes" {
+			os.Exit(96)
+		}
+	}
+	if os.Getenv("HELPER_PRINT_PID") == "1" {
+		fmt.Println(os.Getpid())
+	}
+	if sleep, err := time.ParseDuration(os.Getenv("HELPER_SLEEP")); err == nil {
+		time.Sleep(sleep)
+	}
+	code, _ := strconv.Atoi(os.Getenv("HELPER_EXIT_CODE"))
+	os.Exit(code)
+}
+
+func helperCommand(t *testing.T, code int) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+	cmd.Env = append(os.Environ(), "GO_WANT_HELPER_PROCESS=1", "HELPER_EXIT_CODE="+strconv.Itoa(code))
+	return cmd
+}
+
+func TestExitCode(t *testing.T) {
+	for _, want := range []int{0, 1, 3, 42} {
+		t.Run(strconv.Itoa(want), func(t *testing.T) {
+			got, err := exitCode(helperCommand(t, want).Run())
+			if err != nil {
+				t.Fatalf("exitCode() error = %v", err)
+			}
+			if got != want {
+				t.Errorf("exitCode() = %d, want %d", got, want)
+			}
+		})
+	}
+
+	t.Run("failed to start", func(t *testing.T) {
+		got, err := exitCode(exec.Command("/does/not/exist").Run())
+		if err == nil {
+			t.Fatal("exitCode() expected an error")
+		}
+		if got != 1 {
+			t.Errorf("exitCode() = %d, want 1", got)
+		}
+	})
+}
+
+func TestExecArgv(t *testing.T) {
+	originalArgs := os.Args
+	t.Cleanup(func() { os.Args = originalArgs })
+	os.Args = []string{filepath.Join("usr", "local", "bin", "cdkts"), "plan"}
+
+	got := execArgv([]string{"run", "-q", "-A", "jsr:cli", "plan"})
+	want := []string{"cdkts", "run", "-q", "-A", "jsr:cli", "plan"}
+	if !slices.Equal(got, want) {
+		t.Errorf("execArgv() = %q, want %q", got, want)
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"no separator", []string{"run", "jsr:cli", "plan"}, []string{"run", "jsr:cli", "plan"}},
+		{"trailing separator", []string{"run", "jsr:cli", "plan", "--"}, []string{"run", "jsr:cli", "plan", "--"}},
+		{"pass through", []string{"run", "jsr:cli", "plan", "--", "-var=password=hunter2", "-lock=false"}, []string{"run", "jsr:cli", "plan", "--", "<2 args redacted>"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := slices.Clone(tt.args)
+			if got := redactArgs(args); !slices.Equal(got, tt.want) {
+				t.Errorf("redactArgs() = %q, want %q", got, tt.want)
+			}
+			if !slices.Equal(args, tt.args) {
+				t.Errorf("redactArgs() modified its input: %q", args)
+			}
+		})
+	}
+}
+
+func TestExecError(t *testing.T) {
+	err := error(&execError{"/cache/deno", []string{"run", "jsr:cli", "plan", "--", "-var=secret=x"}, errExecFormat})
+	want := "failed to run /cache/deno run jsr:cli plan -- '<1 args redacted>': " + errExecFormat.Error()
+	if runtime.GOOS == "windows" {
+		want = "failed to run /cache/deno run jsr:cli plan -- \"<1 args redacted>\": " + errExecFormat.Error()
+	}
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, errExecFormat) {
+		t.Error("errors.Is(err, errExecFormat) = false, want true")
+	}
+
+	_, err = runBinary(filepath.Join(t.TempDir(), "missing"), []string{"--version"}, 0)
+	var execErr *execError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("runBinary() error = %v, want an *execError", err)
+	}
+}
+
+func TestChildTimeout(t *testing.T) {
+	tests := []struct {
+		env     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"30m", 30 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"0s", 0, true},
+		{"-1m", 0, true},
+		{"30", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("CDKTS_TIMEOUT", tt.env)
+			got, err := childTimeout()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("childTimeout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("childTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunBinaryTimeout(t *testing.T) {
+	t.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	t.Setenv("HELPER_SLEEP", "1m")
+
+	start := time.Now()
+	code, err := runBinary(os.Args[0], []string{"-test.run=TestHelperProcess"}, 200*time.Millisecond)
+	if !errors.Is(err, errTimeout) {
+		t.Fatalf("runBinary() error = %v, want errTimeout", err)
+	}
+	if code != exitTimeout {
+		t.Errorf("runBinary() = %d, want %d", code, exitTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("runBinary() took %s, the child was not killed", elapsed)
+	}
+
+	t.Setenv("HELPER_SLEEP", "")
+	t.Setenv("HELPER_EXIT_CODE", "3")
+	if code, err := runBinary(os.Args[0], []string{"-test.run=TestHelperProcess"}, time.Minute); err != nil || code != 3 {
+		t.Errorf("runBinary() = %d, %v, want 3, nil", code, err)
+	}
+}
+
+func TestRunBinaryForceTTY(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("CDKTS_FORCE_TTY is only supported on Linux & macOS")
+	}
+	t.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	t.Setenv("HELPER_WANT_TTY", "1")
+	t.Setenv("HELPER_EXIT_CODE", "3")
+	t.Setenv("CDKTS_FORCE_TTY", "1")
+
+	// Our stdout is a plain file, but the child must see a terminal & all of
+	// its output must still make it through, without any "\r" added to it
+	stdout, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	original := os.Stdout
+	os.Stdout = stdout
+	code, err := runBinary(os.Args[0], []string{"-test.run=TestHelperProcess"}, 0)
+	os.Stdout = original
+
+	if err != nil || code != 3 {
+		t.Fatalf("runBinary() = %d, %v, want 3, nil", code, err)
+	}
+	if got, _ := os.ReadFile(stdout.Name()); string(got) != "line 1\nline 2\n" {
+		t.Errorf("stdout = %q, want %q", got, "line 1\nline 2\n")
+	}
+}
+
+func TestLaunchDeno(t *testing.T) {
+	tests := []struct {
+		name      string
+		supervise string
+		wantChild bool
+	}{
+		{"exec", "", runtime.GOOS == "windows"},
+		{"supervise", "1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := helperCommand(t, 7)
+			cmd.Env = append(cmd.Env, "HELPER_LAUNCH=1", "HELPER_PRINT_PID=1", "CDKTS_SUPERVISE="+tt.supervise, "CDKTS_TIMEOUT=", "CDKTS_FORCE_TTY=", "CDKTS_LOG_FILE=")
+			out, err := cmd.Output()
+			code, err := exitCode(err)
+			if err != nil || code != 7 {
+				t.Fatalf("exit code = %d, %v, want 7", code, err)
+			}
+
+			// Exec replaces the wrapper, so deno has the same PID it did
+			pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+			if err != nil {
+				t.Fatalf("output = %q, want a PID", out)
+			}
+			if child := pid != cmd.Process.Pid; child != tt.wantChild {
+				t.Errorf("deno ran as a child = %t, want %t", child, tt.wantChild)
+			}
+		})
+	}
+}
+
+func TestRunBinaryLogFile(t *testing.T) {
+	t.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	t.Setenv("HELPER_OUTPUT", "1")
+	t.Setenv("HELPER_EXIT_CODE", "3")
+	logFile := filepath.Join(t.TempDir(), "cdkts.log")
+	if err := os.WriteFile(logFile, []byte("previous run\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CDKTS_LOG_FILE", logFile)
+
+	stdout := captureOutput(t, &os.Stdout)
+	stderr := captureOutput(t, &os.Stderr)
+	code, err := runBinary(os.Args[0], []string{"-test.run=TestHelperProcess"}, 0)
+	if err != nil || code != 3 {
+		t.Fatalf("runBinary() = %d, %v, want 3, nil", code, err)
+	}
+
+	// Both still reach the terminal, and are appended to the log
+	if got := string(stdout()); got != "line 1\n" {
+		t.Errorf("stdout = %q, want %q", got, "line 1\n")
+	}
+	if got := string(stderr()); got != "line 2\n" {
+		t.Errorf("stderr = %q, want %q", got, "line 2\n")
+	}
+	got, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(got), "previous run\n") || !strings.Contains(string(got), "line 1\n") || !strings.Contains(string(got), "line 2\n") {
+		t.Errorf("log file = %q, want both lines appended", got)
+	}
+}
+
+func TestRetryQuarantined(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "deno")
+	t.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	t.Setenv("HELPER_EXIT_CODE", "5")
+
+	t.Run("re-extracted", func(t *testing.T) {
+		// The binary vanished between extraction and exec
+		path := missing
+		launch := func() (int, error) {
+			return runBinary(path, []string{"-test.run=TestHelperProcess"}, 0)
+		}
+		reextract := func() error {
+			path = os.Args[0]
+			return nil
+		}
+		code, err := retryQuarantined(launch, reextract)
+		if err != nil || code != 5 {
+			t.Errorf("retryQuarantined() = %d, %v, want 5, nil", code, err)
+		}
+	})
+
+	t.Run("still missing", func(t *testing.T) {
+		launches := 0
+		launch := func() (int, error) {
+			launches++
+			return runBinary(missing, []string{"-test.run=TestHelperProcess"}, 0)
+		}
+		_, err := retryQuarantined(launch, func() error { return nil })
+		if !isQuarantined(err) {
+			t.Errorf("retryQuarantined() error = %v, want it quarantined", err)
+		}
+		if launches != 2 {
+			t.Errorf("launched %d times, want 2", launches)
+		}
+	})
+
+	t.Run("not ours", func(t *testing.T) {
+		// Eg: the system deno, which must never be replaced with ours
+		launches := 0
+		launch := func() (int, error) {
+			launches++
+			return runBinary(missing, []string{"-test.run=TestHelperProcess"}, 0)
+		}
+		_, err := retryQuarantined(launch, nil)
+		if !isQuarantined(err) {
+			t.Errorf("retryQuarantined() error = %v, want it quarantined", err)
+		}
+		if launches != 1 {
+			t.Errorf("launched %d times, want 1", launches)
+		}
+	})
+
+	t.Run("other errors", func(t *testing.T) {
+		launches := 0
+		launch := func() (int, error) {
+			launches++
+			return 1, &execError{missing, nil, errExecFormat}
+		}
+		retryQuarantined(launch, func() error { return nil })
+		if launches != 1 {
+			t.Errorf("launched %d times, want 1", launches)
+		}
+	})
+}
+
+func TestCheckCommandLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		argv    []string
+		wantErr bool
+	}{
+		{"short", []string{"cdkts", "run", "jsr:cli", "plan", "--", "-var=a=b"}, false},
+		{"just fits", []string{strings.Repeat("a", maxCommandLine-1)}, false},
+		{"too long", []string{strings.Repeat("a", maxCommandLine)}, true},
+		{"many vars", append([]string{"cdkts", "run", "jsr:cli", "plan", "--"}, slices.Repeat([]string{"-var=key=some value"}, 2000)...), true},
+		{"quoting counts", []string{strings.Repeat(" ", maxCommandLine-2)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCommandLine(tt.argv)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkCommandLine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+var procGenerateConsoleCtrlEvent = modkernel32.NewProc("GenerateConsoleCtrlEvent")
+
+const ctrlBreakEvent = 1
+
+// errExecFormat is returned when the binary was built for another architecture.
+const errExecFormat syscall.Errno = 193 // ERROR_BAD_EXE_FORMAT
+
+// execBinary executes the binary at the given path with the provided arguments
+// and returns the exit code of the child for the wrapper to exit with.
+// On Windows, syscall.Exec is not available, so we always run a child process.
+func execBinary(binaryPath string, args []string) (int, error) {
+	return runBinary(binaryPath, args, 0)
+}
+
+// The child is started in its own process group, which means it no longer sees
+// Ctrl+C from the console. Instead we catch the interrupt ourselves and relay
+// it as a Ctrl+Break to the group, so deno and any terraform it spawned get a
+// chance to shut down cleanly rather than being orphaned.
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+func configureChild(cmd *exec.Cmd, isolated bool) func() {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+	return func() {}
+}
+
+func forwardSignal(cmd *exec.Cmd, sig os.Signal, isolated bool) {
+	procGenerateConsoleCtrlEvent.Call(ctrlBreakEvent, uintptr(cmd.Process.Pid))
+}
+
+// killProcessTree kills the child along with everything it started. Windows
+// has no process groups in the unix sense, taskkill walks the tree for us.
+func killProcessTree(cmd *exec.Cmd) {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		cmd.Process.Kill()
+	}
+}
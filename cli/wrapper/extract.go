@@ -0,0 +1,472 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What we know about the embedded deno binary: the SHA-256 of it decompressed,
+// so we can verify an extracted copy, its version, the GOOS/GOARCH it was
+// built for, eg: linux/amd64, and its size in bytes decompressed, so a
+// truncated embed is caught as soon as it's extracted. All are set by the
+// build script with, eg:
+//
+//	go build -ldflags "-X main.denoSha256=<sha> -X main.denoVersion=<version> -X main.denoTarget=<os>/<arch> -X main.denoSize=<bytes>"
+//
+// A build without them, eg: a local go run with just deno.gz, skips the checks
+// they allow and assumes deno was built for the same platform as the wrapper.
+var (
+	denoSha256  string
+	denoVersion string
+	denoTarget  string
+	denoSize    string
+)
+
+// expectedDenoSha256 is the hash of the decompressed embedded deno, or empty
+// when the build didn't provide one.
+func expectedDenoSha256() string {
+	return strings.TrimSpace(denoSha256)
+}
+
+// embeddedDenoVersion is the version of the embedded deno, or empty when the
+// build didn't provide one.
+func embeddedDenoVersion() string {
+	return strings.TrimSpace(denoVersion)
+}
+
+// embeddedDenoTarget is the GOOS/GOARCH the embedded deno was built for, taken
+// to be ours when the build didn't say.
+func embeddedDenoTarget() string {
+	if target := strings.TrimSpace(denoTarget); target != "" {
+		return target
+	}
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// A real deno binary compresses to tens of megabytes, anything smaller than
+// this means the build did not embed it properly.
+const minDenoCompressedSize = 1 << 20
+
+var errCorruptDeno = errors.New("embedded deno binary is corrupt; this is a broken build")
+
+// errNoexec means a dir can't be extracted into, it's mounted noexec.
+var errNoexec = errors.New("mounted noexec, so deno can't be run from it")
+
+// noexecDir is isNoexecMount, swapped out by tests.
+var noexecDir = isNoexecMount
+
+// checkEmbeddedDeno guards against a misconfigured build that embedded an
+// empty or truncated deno.gz, which would otherwise fail with an opaque
+// decompression error deep inside extractDeno.
+func checkEmbeddedDeno() error {
+	if len(denoCompressedBytes) < minDenoCompressedSize {
+		return fmt.Errorf("embedded deno binary is missing (%d bytes); this is a broken build", len(denoCompressedBytes))
+	}
+	_, err := expectedDenoSize()
+	return err
+}
+
+// expectedDenoSize parses denoSize, 0 means the build didn't provide one, so
+// the size isn't checked.
+func expectedDenoSize() (int64, error) {
+	if strings.TrimSpace(denoSize) == "" {
+		return 0, nil
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(denoSize), 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("embedded deno size %q is invalid; this is a broken build", strings.TrimSpace(denoSize))
+	}
+	return size, nil
+}
+
+// checkDenoTarget makes sure the embedded deno was built for the same platform
+// as this wrapper, so a packaging mistake is reported clearly rather than as
+// an exec format error.
+func checkDenoTarget() error {
+	target := embeddedDenoTarget()
+	if wrapper := runtime.GOOS + "/" + runtime.GOARCH; target != wrapper {
+		return fmt.Errorf("this cdkts build bundles deno for %s but you're on %s", target, wrapper)
+	}
+	return nil
+}
+
+func sha256Sum(data []byte) string {
+	hash := sha256.Sum256(data)
+	return fmt.Sprintf("%x", hash)
+}
+
+// fileSha256 streams the file at path through a SHA-256 hasher.
+func fileSha256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// verifyDeno checks that the file at path exists and that its content matches
+// the known hash of the embedded deno binary. This catches partial writes left
+// behind by an interrupted extraction.
+func verifyDeno(path string) error {
+	actual, err := fileSha256(path)
+	if err != nil {
+		return err
+	}
+	return checkDenoSha256(actual)
+}
+
+// denoStamp identifies the file described by info, as verified to have the
+// hash of the embedded deno, without having to read it: by its size & mtime.
+func denoStamp(info os.FileInfo) string {
+	return fmt.Sprintf("%s %d %d\n", expectedDenoSha256(), info.Size(), info.ModTime().UnixNano())
+}
+
+// writeDenoStamp records that the file at path has been verified in a
+// <path>.ok sidecar. It's only an optimisation, so errors are ignored.
+func writeDenoStamp(path string) {
+	if info, err := os.Stat(path); err == nil {
+		os.WriteFile(path+".ok", []byte(denoStamp(info)), 0644)
+	}
+}
+
+// verifyDenoCached is verifyDeno without the cost of hashing ~100MB on every
+// run. Hashing is skipped when the sidecar left by writeDenoStamp shows the
+// file hasn't changed since it was last verified.
+func verifyDenoCached(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if stamp, err := os.ReadFile(path + ".ok"); err == nil && string(stamp) == denoStamp(info) {
+		return nil
+	}
+	if err := verifyDeno(path); err != nil {
+		os.Remove(path + ".ok")
+		return err
+	}
+	writeDenoStamp(path)
+	return nil
+}
+
+// checkDenoSha256 compares actual with the known hash of the embedded deno,
+// if there is one.
+func checkDenoSha256(actual string) error {
+	expected := expectedDenoSha256()
+	if expected == "" {
+		debugf("no hash was built in for the embedded deno, skipping integrity check")
+		return nil
+	}
+	if actual != expected {
+		return fmt.Errorf("hash mismatch, expected %s got %s", expected, actual)
+	}
+	return nil
+}
+
+// extractDeno decompresses the embedded deno binary to path. The data is first
+// written to a temporary file in the same directory and then renamed into place
+// so that concurrent invocations never observe a half written binary.
+//
+// Transient filesystem errors (antivirus, busy network shares) are retried a
+// few times with backoff, the partial file being removed between attempts.
+//
+// size is the expected size of the decompressed binary, see expectedDenoSize.
+// The SHA-256 of what was written is returned, hashed as it was streamed to
+// disk, for the caller to compare without reading the binary back in.
+func extractDeno(path string, size int64) (string, error) {
+	var sum string
+	err := retryTransient(3, 100*time.Millisecond, func() error {
+		var err error
+		sum, err = extractDenoOnce(path, size)
+		return err
+	})
+	return sum, err
+}
+
+func extractDenoOnce(path string, size int64) (string, error) {
+	// Every writer gets its own temp file, CreateTemp opens it with O_EXCL so
+	// concurrent extractions, even from the same process, never share one. The
+	// extension is kept last, on Windows it must be .exe to be launchable.
+	ext := exeSuffix()
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), strings.TrimSuffix(filepath.Base(path), ext)+".tmp.*"+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	sum, err := writeDeno(tmpFile, size)
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+
+	if err := renameFile(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		// Whoever beat us to it left a copy that's just as good as ours
+		if verifyDeno(path) == nil {
+			return sum, nil
+		}
+		return "", fmt.Errorf("failed to move file into place: %w", err)
+	}
+
+	return sum, nil
+}
+
+// writeDeno decompresses the embedded deno binary into outFile, closing it,
+// and returns the SHA-256 of what was written.
+func writeDeno(outFile *os.File, size int64) (string, error) {
+	path := outFile.Name()
+
+	// Create the decompressor, gzip or zstd depending on the build
+	reader, err := newDenoReader(denoCompressedBytes)
+	if err != nil {
+		outFile.Close()
+		return "", fmt.Errorf("%w: failed to create decompressor: %w", errCorruptDeno, err)
+	}
+	defer reader.Close()
+
+	// Stream decompressed data directly to file, hashing it on the way, so
+	// only a small buffer is ever held in memory. A corrupt stream means a bad
+	// build not a bad disk, so it's reported as such.
+	hash := sha256.New()
+	dest := io.MultiWriter(outFile, hash)
+	if envBool("CDKTS_DEBUG") && isTerminal(os.Stderr) {
+		dest = io.MultiWriter(dest, newByteCounter(os.Stderr, size))
+	}
+	written, err := io.Copy(dest, reader)
+	if err != nil {
+		outFile.Close()
+		if isCorruptStream(err) {
+			return "", fmt.Errorf("%w: %w", errCorruptDeno, err)
+		}
+		return "", fmt.Errorf("failed to decompress and write data: %w", err)
+	}
+	if size > 0 && written != size {
+		outFile.Close()
+		return "", fmt.Errorf("%w: decompressed %d bytes, expected %d", errCorruptDeno, written, size)
+	}
+
+	// Flush to disk before the file becomes visible at its final path
+	if err := outFile.Sync(); err != nil {
+		outFile.Close()
+		return "", fmt.Errorf("failed to sync file: %w", err)
+	}
+
+	// Close the file before setting permissions
+	if err := outFile.Close(); err != nil {
+		return "", fmt.Errorf("failed to close file: %w", err)
+	}
+
+	if err := makeExecutable(path); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// renameFile atomically moves from to to. On Windows a rename over an existing
+// file fails while that file is open (eg: another cdkts is running it), so we
+// retry a few times and accept a valid binary that some other process put there.
+func renameFile(from, to string) error {
+	err := os.Rename(from, to)
+	if err == nil || runtime.GOOS != "windows" {
+		return err
+	}
+
+	for attempt := 1; attempt <= 5; attempt++ {
+		if verifyDeno(to) == nil {
+			os.Remove(from)
+			return nil
+		}
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+		if err = os.Rename(from, to); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// ensureEmbeddedDeno extracts the embedded deno binary into the cache dir,
+// unless a valid copy is already there, and returns its path along with
+// whether it had to be extracted.
+//
+// Each of cacheDirs is tried in turn until one works, so a read only cache or
+// temp dir doesn't stop the CLI from running. Failing to use CDKTS_CACHE_DIR
+// is warned about as the user explicitly asked for it.
+func ensureEmbeddedDeno() (string, bool, error) {
+	var errs []error
+	for _, dir := range cacheDirs() {
+		denoPath, extracted, err := ensureEmbeddedDenoIn(dir)
+		if err == nil {
+			debugf("using cache dir %s", dir)
+			return denoPath, extracted, nil
+		}
+		if errors.Is(err, errNoexec) {
+			warnf("%v, falling back to another cache dir", err)
+		} else if dir == os.Getenv("CDKTS_CACHE_DIR") {
+			warnf("unable to use CDKTS_CACHE_DIR, falling back to the default cache dir: %v", err)
+		} else {
+			debugf("unable to use cache dir %s: %v", dir, err)
+		}
+		errs = append(errs, err)
+	}
+	return "", false, errors.Join(errs...)
+}
+
+// embeddedDenoPath builds a unique path in dir for the embedded deno binary
+// based on its content hash. The wrapper version is only there to show which
+// release extracted it, eg: cdkts-0.8.0-embedded-<hash>.
+func embeddedDenoPath(dir string) string {
+	version := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune(".+-", r) {
+			return r
+		}
+		return '_'
+	}, cdkTsVersion)
+	return filepath.Join(dir, "cdkts-"+version+"-embedded-"+sha256Sum(denoCompressedBytes)+exeSuffix())
+}
+
+// exeSuffix is the file extension executables must have on this platform.
+func exeSuffix() string {
+	if runtime.GOOS == "windows" {
+		return ".exe"
+	}
+	return ""
+}
+
+// ensureEmbeddedDenoIn does the work of ensureEmbeddedDeno for a given dir.
+func ensureEmbeddedDenoIn(dir string) (string, bool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", false, fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	if noexecDir(dir) {
+		return "", false, fmt.Errorf("%s is %w", dir, errNoexec)
+	}
+
+	denoPath := embeddedDenoPath(dir)
+
+	// Serialize extraction across concurrent invocations. Whoever gets the lock
+	// first does the work, everyone else waits and then finds a valid binary.
+	lock, err := acquireLock(denoPath+".lock", 30*time.Second)
+	if err != nil {
+		warnf("proceeding without extraction lock: %v", err)
+	} else {
+		defer releaseLock(lock)
+	}
+
+	// Check if the file already exists and is valid before writing it again,
+	// unless CDKTS_FORCE_EXTRACT asks us to write it regardless
+	extracted := false
+	err = verifyDenoCached(denoPath)
+	if err == nil && envBool("CDKTS_FORCE_EXTRACT") {
+		err = errors.New("CDKTS_FORCE_EXTRACT is set")
+	}
+	if err != nil {
+		// If not found or corrupt, write the compressed bytes to the file and decompress it
+		debugf("extracting deno to %s: %v", denoPath, err)
+		size, err := expectedDenoSize()
+		if err != nil {
+			return "", false, err
+		}
+		done := progress("extracting bundled deno (first run)…")
+		sum, err := extractDeno(denoPath, size)
+		done()
+		if err != nil {
+			return "", false, err
+		}
+		if err := checkDenoSha256(sum); err != nil {
+			return "", false, fmt.Errorf("extracted deno failed verification: %w", err)
+		}
+		writeDenoStamp(denoPath)
+		extracted = true
+	}
+
+	// Now is a good time to clean up after previous releases
+	removeStaleDenos(filepath.Dir(denoPath), denoPath, 7*24*time.Hour)
+
+	return denoPath, extracted, nil
+}
+
+// reextractDeno replaces the deno binary at denoPath, an extracted copy that
+// has since gone missing or become unusable.
+func reextractDeno(denoPath string) error {
+	size, err := expectedDenoSize()
+	if err != nil {
+		return err
+	}
+
+	// Others may be extracting it too, or just about to run it, so this takes
+	// the same lock as ensureEmbeddedDenoIn
+	lock, err := acquireLock(denoPath+".lock", 30*time.Second)
+	if err != nil {
+		warnf("proceeding without extraction lock: %v", err)
+	} else {
+		defer releaseLock(lock)
+	}
+
+	os.Remove(denoPath + ".ok")
+	os.Remove(denoPath)
+	sum, err := extractDeno(denoPath, size)
+	if err != nil {
+		return err
+	}
+	if err := checkDenoSha256(sum); err != nil {
+		return fmt.Errorf("extracted deno failed verification: %w", err)
+	}
+	writeDenoStamp(denoPath)
+	return nil
+}
+
+// extractTempDeno extracts the embedded deno binary into a new temp dir, for
+// when CDKTS_NO_CACHE asks for nothing to be left behind. The returned cleanup
+// func removes it again and must be called once deno has exited.
+func extractTempDeno() (string, func(), error) {
+	dir, err := os.MkdirTemp("", "cdkts-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	if noexecDir(dir) {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("%s is %w, set TMPDIR to somewhere that isn't", dir, errNoexec)
+	}
+
+	size, err := expectedDenoSize()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	denoPath := embeddedDenoPath(dir)
+	if _, err := extractDeno(denoPath, size); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+
+	cleanup := func() {
+		// Windows may hold on to the exe for a moment after the process exits
+		for attempt := 1; ; attempt++ {
+			err := os.RemoveAll(dir)
+			if err == nil {
+				return
+			}
+			if attempt == 5 {
+				warnf("failed to remove %s: %v", dir, err)
+				return
+			}
+			time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+		}
+	}
+	return denoPath, cleanup, nil
+}
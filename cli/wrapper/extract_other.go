@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// makeExecutable marks the freshly extracted deno binary as executable.
+func makeExecutable(path string) error {
+	if err := os.Chmod(path, 0755); err != nil {
+		return fmt.Errorf("failed to set file permissions: %w", err)
+	}
+	return nil
+}
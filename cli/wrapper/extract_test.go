@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEnsureEmbeddedDenoCacheDir(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("LOCALAPPDATA", os.Getenv("XDG_CACHE_HOME"))
+
+	t.Run("override", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "created")
+		t.Setenv("CDKTS_CACHE_DIR", dir)
+
+		denoPath, extracted, err := ensureEmbeddedDeno()
+		if err != nil {
+			t.Fatalf("ensureEmbeddedDeno() error = %v", err)
+		}
+		if !extracted {
+			t.Error("ensureEmbeddedDeno() extracted = false, want true")
+		}
+		if filepath.Dir(denoPath) != dir {
+			t.Errorf("ensureEmbeddedDeno() = %q, want it in %q", denoPath, dir)
+		}
+
+		_, extracted, err = ensureEmbeddedDeno()
+		if err != nil {
+			t.Fatalf("ensureEmbeddedDeno() error = %v", err)
+		}
+		if extracted {
+			t.Error("ensureEmbeddedDeno() extracted = true on reuse, want false")
+		}
+	})
+
+	t.Run("unusable override falls back", func(t *testing.T) {
+		// A dir under a regular file can never be created, regardless of
+		// platform or whether we are running as root.
+		file := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		dir := filepath.Join(file, "cache")
+		t.Setenv("CDKTS_CACHE_DIR", dir)
+
+		denoPath, _, err := ensureEmbeddedDeno()
+		if err != nil {
+			t.Fatalf("ensureEmbeddedDeno() error = %v", err)
+		}
+		if want := cacheDirs()[1]; filepath.Dir(denoPath) != want {
+			t.Errorf("ensureEmbeddedDeno() = %q, want it in %q", denoPath, want)
+		}
+	})
+
+	t.Run("read only cache dir falls back", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("read only directories are not enforced on windows")
+		}
+		dir := t.TempDir()
+		if err := os.Chmod(dir, 0500); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.Chmod(dir, 0700) })
+		if f, err := os.Create(filepath.Join(dir, "probe")); err == nil {
+			f.Close()
+			t.Skip("running as a user that ignores file permissions")
+		}
+		t.Setenv("CDKTS_CACHE_DIR", dir)
+
+		denoPath, _, err := ensureEmbeddedDeno()
+		if err != nil {
+			t.Fatalf("ensureEmbeddedDeno() error = %v", err)
+		}
+		if filepath.Dir(denoPath) == dir {
+			t.Errorf("ensureEmbeddedDeno() = %q, expected a fallback", denoPath)
+		}
+	})
+
+	t.Run("noexec cache dir falls back", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv("CDKTS_CACHE_DIR", dir)
+		noexecDir = func(d string) bool { return d == dir }
+		t.Cleanup(func() { noexecDir = isNoexecMount })
+
+		denoPath, _, err := ensureEmbeddedDeno()
+		if err != nil {
+			t.Fatalf("ensureEmbeddedDeno() error = %v", err)
+		}
+		if want := cacheDirs()[1]; filepath.Dir(denoPath) != want {
+			t.Errorf("ensureEmbeddedDeno() = %q, want it in %q", denoPath, want)
+		}
+		if _, _, err := ensureEmbeddedDenoIn(dir); !errors.Is(err, errNoexec) {
+			t.Errorf("ensureEmbeddedDenoIn() error = %v, want %v", err, errNoexec)
+		}
+	})
+}
+
+func TestEnsureEmbeddedDenoForceExtract(t *testing.T) {
+	dir := t.TempDir()
+	denoPath, _, err := ensureEmbeddedDenoIn(dir)
+	if err != nil {
+		t.Fatalf("ensureEmbeddedDenoIn() error = %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(denoPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CDKTS_FORCE_EXTRACT", "1")
+	_, extracted, err := ensureEmbeddedDenoIn(dir)
+	if err != nil {
+		t.Fatalf("ensureEmbeddedDenoIn() error = %v", err)
+	}
+	if !extracted {
+		t.Error("ensureEmbeddedDenoIn() extracted = false, want true")
+	}
+	if info, err := os.Stat(denoPath); err != nil || !info.ModTime().After(old) {
+		t.Errorf("ensureEmbeddedDenoIn() did not replace %s", denoPath)
+	}
+	if err := verifyDeno(denoPath); err != nil {
+		t.Errorf("verifyDeno() error = %v", err)
+	}
+}
+
+func TestVerifyDenoCached(t *testing.T) {
+	original := denoSha256
+	t.Cleanup(func() { denoSha256 = original })
+	content := []byte("deno")
+	denoSha256 = sha256Sum(content) + "\n"
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "deno")
+	if err := os.WriteFile(path, content, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hashed the first time, which leaves the sidecar behind
+	if err := verifyDenoCached(path); err != nil {
+		t.Fatalf("verifyDenoCached() error = %v", err)
+	}
+	if _, err := os.Stat(path + ".ok"); err != nil {
+		t.Fatalf("verifyDenoCached() did not write the sidecar: %v", err)
+	}
+
+	// Not hashed while the size & mtime match, which is only visible when the
+	// content is changed behind its back without changing either
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("evil"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyDenoCached(path); err != nil {
+		t.Errorf("verifyDenoCached() error = %v, want the hash to be skipped", err)
+	}
+
+	// A new mtime invalidates the sidecar, so the change is caught
+	later := info.ModTime().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyDenoCached(path); err == nil {
+		t.Error("verifyDenoCached() expected a hash mismatch")
+	}
+	if _, err := os.Stat(path + ".ok"); !os.IsNotExist(err) {
+		t.Errorf("verifyDenoCached() left the stale sidecar behind: %v", err)
+	}
+
+	// As does a new size
+	if err := os.WriteFile(path, content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeDenoStamp(path)
+	if err := os.WriteFile(path, []byte("deno, but longer"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyDenoCached(path); err == nil {
+		t.Error("verifyDenoCached() expected a hash mismatch")
+	}
+}
+
+func TestBuildDenoVars(t *testing.T) {
+	originalSha256, originalVersion := denoSha256, denoVersion
+	t.Cleanup(func() { denoSha256, denoVersion = originalSha256, originalVersion })
+	content := sha256Sum([]byte("deno"))
+	other := sha256Sum([]byte("other"))
+
+	tests := []struct {
+		name        string
+		sha256      string
+		version     string
+		wantSha256  string
+		wantVersion string
+		wantErr     bool
+	}{
+		{"set", content, "2.1.0", content, "2.1.0", false},
+		{"set with whitespace", content + "\n", "2.1.0\n", content, "2.1.0", false},
+		{"set mismatch", other, "2.1.0", other, "2.1.0", true},
+		{"unset skips the check", "", "", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			denoSha256, denoVersion = tt.sha256, tt.version
+			if got := expectedDenoSha256(); got != tt.wantSha256 {
+				t.Errorf("expectedDenoSha256() = %q, want %q", got, tt.wantSha256)
+			}
+			if got := embeddedDenoVersion(); got != tt.wantVersion {
+				t.Errorf("embeddedDenoVersion() = %q, want %q", got, tt.wantVersion)
+			}
+			if err := checkDenoSha256(content); (err != nil) != tt.wantErr {
+				t.Errorf("checkDenoSha256() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckEmbeddedDeno(t *testing.T) {
+	original := denoCompressedBytes
+	t.Cleanup(func() { denoCompressedBytes = original })
+
+	for _, size := range []int{0, 1024} {
+		denoCompressedBytes = make([]byte, size)
+		if err := checkEmbeddedDeno(); err == nil {
+			t.Errorf("checkEmbeddedDeno() with %d bytes expected an error", size)
+		}
+	}
+
+	denoCompressedBytes = make([]byte, minDenoCompressedSize)
+	if err := checkEmbeddedDeno(); err != nil {
+		t.Errorf("checkEmbeddedDeno() error = %v", err)
+	}
+
+	originalSize := denoSize
+	t.Cleanup(func() { denoSize = originalSize })
+	for _, size := range []string{"0", "-1", "big"} {
+		denoSize = size
+		if err := checkEmbeddedDeno(); err == nil {
+			t.Errorf("checkEmbeddedDeno() with size %q expected an error", size)
+		}
+	}
+
+	// A build that didn't set the size, eg: a local go run
+	denoSize = ""
+	if err := checkEmbeddedDeno(); err != nil {
+		t.Errorf("checkEmbeddedDeno() with no size error = %v", err)
+	}
+}
+
+func TestCheckDenoTarget(t *testing.T) {
+	original := denoTarget
+	t.Cleanup(func() { denoTarget = original })
+
+	for _, target := range []string{runtime.GOOS + "/" + runtime.GOARCH + "\n", ""} {
+		denoTarget = target
+		if err := checkDenoTarget(); err != nil {
+			t.Errorf("checkDenoTarget() with target %q error = %v", target, err)
+		}
+	}
+
+	denoTarget = "plan9/mips"
+	if err := checkDenoTarget(); err == nil {
+		t.Error("checkDenoTarget() expected an error")
+	}
+}
+
+func TestEmbeddedDenoPath(t *testing.T) {
+	name := "cdkts-" + cdkTsVersion + "-embedded-" + sha256Sum(denoCompressedBytes)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+
+	base := filepath.Join(t.TempDir(), "dir with spaces")
+	for _, dir := range []string{base, base + string(filepath.Separator)} {
+		if got, want := embeddedDenoPath(dir), filepath.Join(base, name); got != want {
+			t.Errorf("embeddedDenoPath(%q) = %q, want %q", dir, got, want)
+		}
+	}
+
+	t.Setenv("CDKTS_CACHE_DIR", base+string(filepath.Separator))
+	denoPath, _, err := ensureEmbeddedDeno()
+	if err != nil {
+		t.Fatalf("ensureEmbeddedDeno() error = %v", err)
+	}
+	if want := filepath.Join(base, name); denoPath != want {
+		t.Errorf("ensureEmbeddedDeno() = %q, want %q", denoPath, want)
+	}
+}
+
+func TestExtractDenoRoundTrip(t *testing.T) {
+	original := denoCompressedBytes
+	t.Cleanup(func() { denoCompressedBytes = original })
+
+	want := bytes.Repeat([]byte("deno"), 64*1024)
+	denoCompressedBytes = compressDeno(t, want)
+
+	path := filepath.Join(t.TempDir(), "deno")
+	sum, err := extractDeno(path, int64(len(want)))
+	if err != nil {
+		t.Fatalf("extractDeno() error = %v", err)
+	}
+	if sum != sha256Sum(want) {
+		t.Errorf("extractDeno() = %s, want %s", sum, sha256Sum(want))
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("extractDeno() wrote %d bytes that do not match the %d compressed", len(got), len(want))
+	}
+}
+
+// Deno is ~100MB decompressed, extracting & hashing it must only ever hold a
+// buffer of it in memory, at most the decompressor's window, which is 8MB for
+// zstd at the level the build script uses.
+func TestExtractDenoBoundedMemory(t *testing.T) {
+	original := denoCompressedBytes
+	t.Cleanup(func() { denoCompressedBytes = original })
+
+	const size = 64 << 20
+	want := bytes.Repeat([]byte("deno"), size/4)
+	denoCompressedBytes = compressDeno(t, want)
+	wantSum := sha256Sum(want)
+	want = nil
+	path := filepath.Join(t.TempDir(), "deno")
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	sum, err := extractDeno(path, size)
+	runtime.ReadMemStats(&after)
+
+	if err != nil {
+		t.Fatalf("extractDeno() error = %v", err)
+	}
+	if sum != wantSum {
+		t.Errorf("extractDeno() = %s, want %s", sum, wantSum)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/4 {
+		t.Errorf("extractDeno() allocated %d bytes to extract %d", allocated, size)
+	}
+}
+
+func TestExtractDenoSizeMismatch(t *testing.T) {
+	original := denoCompressedBytes
+	t.Cleanup(func() { denoCompressedBytes = original })
+
+	denoCompressedBytes = compressDeno(t, bytes.Repeat([]byte("deno"), 1024))
+	dir := t.TempDir()
+
+	_, err := extractDeno(filepath.Join(dir, "deno"), 8192)
+	if !errors.Is(err, errCorruptDeno) {
+		t.Fatalf("extractDeno() error = %v, want %v", err, errCorruptDeno)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("extractDeno() left behind %d files", len(entries))
+	}
+
+	// An unknown size isn't checked
+	if _, err := extractDeno(filepath.Join(dir, "deno"), 0); err != nil {
+		t.Errorf("extractDeno() with no size error = %v", err)
+	}
+}
+
+func TestExtractDenoCorrupt(t *testing.T) {
+	original := denoCompressedBytes
+	t.Cleanup(func() { denoCompressedBytes = original })
+
+	for name, payload := range corruptDenos(t) {
+		t.Run(name, func(t *testing.T) {
+			denoCompressedBytes = payload
+			dir := t.TempDir()
+
+			_, err := extractDeno(filepath.Join(dir, "deno"), 4096)
+			if !errors.Is(err, errCorruptDeno) {
+				t.Fatalf("extractDeno() error = %v, want %v", err, errCorruptDeno)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("extractDeno() left behind %d files", len(entries))
+			}
+		})
+	}
+}
+
+func TestReextractDeno(t *testing.T) {
+	original := denoCompressedBytes
+	t.Cleanup(func() { denoCompressedBytes = original })
+	originalSize, originalSha256 := denoSize, denoSha256
+	t.Cleanup(func() { denoSize, denoSha256 = originalSize, originalSha256 })
+	content := bytes.Repeat([]byte("deno"), 1024)
+	denoCompressedBytes = compressDeno(t, content)
+	denoSize = strconv.Itoa(len(content))
+	denoSha256 = sha256Sum(content)
+
+	denoPath := filepath.Join(t.TempDir(), "deno")
+	if err := os.WriteFile(denoPath, []byte("quarantined"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone else is extracting, nothing may be touched until they're done
+	lock, err := acquireLock(denoPath+".lock", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- reextractDeno(denoPath) }()
+	time.Sleep(200 * time.Millisecond)
+	if got, _ := os.ReadFile(denoPath); string(got) != "quarantined" {
+		t.Error("reextractDeno() replaced deno without holding the lock")
+	}
+	releaseLock(lock)
+
+	if err := <-done; err != nil {
+		t.Fatalf("reextractDeno() error = %v", err)
+	}
+	if got, _ := os.ReadFile(denoPath); !bytes.Equal(got, content) {
+		t.Error("reextractDeno() did not replace deno")
+	}
+	if err := verifyDenoCached(denoPath); err != nil {
+		t.Errorf("verifyDenoCached() error = %v", err)
+	}
+	if _, err := os.Stat(denoPath + ".ok"); err != nil {
+		t.Errorf("reextractDeno() did not stamp deno: %v", err)
+	}
+}
+
+func TestExtractTempDeno(t *testing.T) {
+	original := denoCompressedBytes
+	t.Cleanup(func() { denoCompressedBytes = original })
+
+	// Use the test binary itself as deno, see TestHelperProcess
+	self, err := os.ReadFile(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	originalSize := denoSize
+	t.Cleanup(func() { denoSize = originalSize })
+	denoCompressedBytes = compressDeno(t, self)
+	denoSize = strconv.Itoa(len(self))
+
+	t.Setenv("GO_WANT_HELPER_PROCESS", "1")
+	t.Setenv("HELPER_EXIT_CODE", "7")
+
+	denoPath, cleanup, err := extractTempDeno()
+	if err != nil {
+		t.Fatalf("extractTempDeno() error = %v", err)
+	}
+
+	code, err := runBinary(denoPath, []string{"-test.run=TestHelperProcess"}, 0)
+	if err != nil {
+		t.Fatalf("runBinary() error = %v", err)
+	}
+	if code != 7 {
+		t.Errorf("runBinary() = %d, want 7", code)
+	}
+
+	cleanup()
+	if _, err := os.Stat(filepath.Dir(denoPath)); !os.IsNotExist(err) {
+		t.Errorf("cleanup() left %s behind", filepath.Dir(denoPath))
+	}
+}
+
+func TestExtractDenoConcurrent(t *testing.T) {
+	original := denoCompressedBytes
+	t.Cleanup(func() { denoCompressedBytes = original })
+
+	want := bytes.Repeat([]byte("deno"), 64*1024)
+	denoCompressedBytes = compressDeno(t, want)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "deno")
+	errs := make(chan error, 8)
+	for range cap(errs) {
+		go func() {
+			_, err := extractDeno(path, int64(len(want)))
+			errs <- err
+		}()
+	}
+	for range cap(errs) {
+		if err := <-errs; err != nil {
+			t.Errorf("extractDeno() error = %v", err)
+		}
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("extractDeno() raced into a corrupt binary")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("extractDeno() left behind %d files, want just deno", len(entries))
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+)
+
+// makeExecutable makes sure the freshly extracted deno binary can be run.
+//
+// Unix style permission bits mean nothing on Windows, whether an .exe may be
+// launched is decided by ACLs & policies such as AppLocker. Rather than trying
+// to reason about those we simply try to launch it, so a blocked binary is
+// reported here instead of as a confusing failure later on.
+func makeExecutable(path string) error {
+	if _, err := exitCode(exec.Command(path, "--version").Run()); err != nil {
+		return fmt.Errorf("extracted deno can not be launched, check your security policy allows running executables from %s: %w", filepath.Dir(path), err)
+	}
+	return nil
+}
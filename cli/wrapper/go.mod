@@ -1,3 +1,5 @@
 module github.com/brad-jones/cdkts/cli/wrapper
 
 go 1.25.7
+
+require github.com/klauspost/compress v1.18.0
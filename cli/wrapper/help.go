@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// helpEntry is a single wrapper level knob listed by wrapper-help.
+type helpEntry struct {
+	name string
+	desc string
+}
+
+// helpSection groups related entries under a heading.
+type helpSection struct {
+	title   string
+	entries []helpEntry
+}
+
+// helpSections documents everything the Go wrapper itself understands, the
+// CLI documents the rest via its own --help.
+var helpSections = []helpSection{
+	{"Commands", []helpEntry{
+		{"wrapper-help", "Print this help, then exit"},
+		{"wrapper-doctor", "Check deno can be extracted & run, JSR is reachable and tofu/terraform can be found"},
+		{"wrapper-prefetch", "Extract deno & fetch the CLI into the cache without running it"},
+		{"wrapper-env [--json]", "Print the versions, deno path & cache dir the wrapper resolved"},
+		{"wrapper-clean-cache", "Remove every deno binary the wrapper extracted"},
+	}},
+	{"Flags", []helpEntry{
+		{"--version, -V", "As the first argument, print the wrapper, CLI & deno versions, then exit"},
+		{"--deno-version", "Print the version of the embedded deno, then exit"},
+		{"--print-deno-path", "Print the path & SHA-256 of the deno the wrapper would run, then exit"},
+		{"--wrapper-dry-run", "Print the deno command the wrapper would run, then exit"},
+		{"--wrapper-chdir <dir>", "Run as if cdkts was started in dir, like git -C"},
+		{"@<file>", "Replaced by the arguments in file, one or more per line, quotes group spaces"},
+	}},
+	{"Environment", []helpEntry{
+		{"CDKTS_CHDIR", "Same as --wrapper-chdir"},
+		{"CDKTS_DENO_PATH", "Run this deno instead of the embedded one"},
+		{"CDKTS_USE_VERSION_FILE", "Run the asdf/mise deno pinned by .deno-version or .tool-versions, if installed"},
+		{"CDKTS_PREFER_SYSTEM_DENO", "Run the deno on PATH if it is exactly the embedded version"},
+		{"CDKTS_CACHE_DIR", "Extract deno here instead of the per-user cache dir"},
+		{"CDKTS_NO_CACHE", "Extract deno to a temp dir that is removed on exit"},
+		{"CDKTS_FORCE_EXTRACT", "Extract deno again even if a valid copy is cached"},
+		{"CDKTS_DENO_DIR", "Export as DENO_DIR, where deno caches the CLI"},
+		{"CDKTS_VERSION", "Run this version of the CLI instead of " + cdkTsVersion},
+		{"CDKTS_LOCAL_MAIN", "Run this local cli/main.ts instead of the CLI from JSR"},
+		{"CDKTS_REGISTRY_BASE", "Fetch the CLI from this JSR mirror"},
+		{"CDKTS_PROXY", "Proxy URL for HTTP_PROXY & HTTPS_PROXY when unset"},
+		{"CDKTS_OFFLINE", "Run deno with --cached-only"},
+		{"CDKTS_NO_NET_CHECK", "Skip checking JSR is reachable & has the CLI version on its first run"},
+		{"CDKTS_DENO_PERMISSIONS", "Permission flags, or locked, to run the CLI with instead of -A"},
+		{"CDKTS_DENO_FLAGS", "Extra deno runtime flags, shell quoted"},
+		{"CDKTS_DEFAULT_FLAGS_<COMMAND>", "Flags to add to a command unless given, eg: CDKTS_DEFAULT_FLAGS_APPLY=\"-- -auto-approve\""},
+		{"CDKTS_LOCK", "Path to a deno.lock the CLI must match"},
+		{"CDKTS_INTEGRITY", "sha256-<base64> integrity the CLI package must match"},
+		{"CDKTS_TIMEOUT", "Kill the CLI after this duration, eg: 30m, exiting with 124"},
+		{"CDKTS_FORCE_TTY", "Run the CLI on a pseudo terminal so it stays colored when piped (Linux & macOS)"},
+		{"CDKTS_SUPERVISE", "Run the CLI as a child of the wrapper rather than replacing it"},
+		{"CDKTS_LOG_FILE", "Also append the CLI's output to this file"},
+		{"CDKTS_PRE_RUN", "Command to run before the CLI, eg: a credential helper, aborting if it fails"},
+		{"CDKTS_PRE_RUN_TIMEOUT", "Kill CDKTS_PRE_RUN after this duration, default 5m"},
+		{"CDKTS_POST_RUN", "Command to run after the CLI, given its exit code as CDKTS_EXIT_CODE"},
+		{"CDKTS_POST_RUN_TIMEOUT", "Kill CDKTS_POST_RUN after this duration, default 5m"},
+		{"CDKTS_DRY_RUN", "Same as --wrapper-dry-run"},
+		{"CDKTS_DEBUG", "Log what the wrapper decided to stderr"},
+		{"CDKTS_NO_HINTS", "Silence hints"},
+		{"CDKTS_ERROR_FORMAT", "Set to json to report a fatal wrapper error as a JSON object"},
+		{"CDKTS_TELEMETRY", "Opt in to anonymous failure reports, along with CDKTS_TELEMETRY_URL"},
+		{"CDKTS_TELEMETRY_URL", "Where to POST failure reports"},
+		{"NO_COLOR", "Disable colors in the wrapper's own output"},
+	}},
+}
+
+// printHelp writes the wrapper-help text to w.
+func printHelp(w io.Writer) {
+	fmt.Fprintln(w, "Usage: cdkts [wrapper flags] <command> [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "These are handled by the wrapper, run cdkts --help for the CLI's own help.")
+	fmt.Fprintln(w, "Defaults for most variables can also be set in a .cdktsrc file.")
+
+	width := 0
+	for _, section := range helpSections {
+		for _, entry := range section.entries {
+			width = max(width, len(entry.name))
+		}
+	}
+	for _, section := range helpSections {
+		fmt.Fprintf(w, "\n%s:\n", section.title)
+		for _, entry := range section.entries {
+			fmt.Fprintf(w, "  %-*s  %s\n", width, entry.name, entry.desc)
+		}
+	}
+}
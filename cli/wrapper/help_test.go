@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Every CDKTS_* variable the wrapper reads must be listed by wrapper-help.
+func TestPrintHelpListsEveryVariable(t *testing.T) {
+	var out strings.Builder
+	printHelp(&out)
+	help := out.String()
+
+	// Read by the TypeScript CLI, the wrapper only looks at them, eg: in
+	// wrapper-doctor or to grant permissions for them
+	ignored := map[string]bool{"CDKTS_TF_BINARY_PATH": true, "CDKTS_PROJECT_DIR": true}
+
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern := regexp.MustCompile(`"(CDKTS_[A-Z_]+)"`)
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range pattern.FindAllStringSubmatch(string(src), -1) {
+			if name := match[1]; !ignored[name] && !strings.Contains(help, name) {
+				t.Errorf("%s is read in %s but missing from wrapper-help", name, file)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// defaultHookTimeout applies to hooks without a <name>_TIMEOUT, so that, eg:
+// a credential helper waiting for input that never comes can't hang CI.
+const defaultHookTimeout = 5 * time.Minute
+
+// errHookFailed means a hook ran, but exited with a non zero code.
+var errHookFailed = errors.New("failed")
+
+// runHook runs the command in the environment variable name, eg:
+// CDKTS_PRE_RUN, if it's set. The command is shell quoted, like
+// CDKTS_DENO_FLAGS, and run directly rather than via a shell, so it behaves
+// the same on every platform.
+//
+// It's run as a child, even on Unix, as we need to outlive it. Its stdout goes
+// to our stderr, stdout being reserved for the CLI's output which may be
+// consumed as JSON. It's killed, along with everything it started, if it
+// runs for longer than <name>_TIMEOUT.
+//
+// env is added to the hook's environment.
+//
+// The returned exit code is what the wrapper should exit with when the error
+// is non nil, which is the hook's own exit code if it failed.
+func runHook(name string, env ...string) (int, error) {
+	argv, err := shellSplit(os.Getenv(name))
+	if err != nil {
+		return exitUsage, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	if len(argv) == 0 {
+		return 0, nil
+	}
+	timeout, err := durationEnv(name + "_TIMEOUT")
+	if err != nil {
+		return exitUsage, err
+	}
+	if timeout == 0 {
+		timeout = defaultHookTimeout
+	}
+
+	debugf("running %s: %q", name, argv)
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	defer configureChild(cmd, true)()
+	if err := cmd.Start(); err != nil {
+		return exitUsage, fmt.Errorf("failed to run %s: %w", name, err)
+	}
+
+	code, timedOut, err := waitChild(cmd, true, timeout)
+	switch {
+	case timedOut:
+		return exitTimeout, fmt.Errorf("%w: %s was killed after running for longer than %s", errTimeout, name, timeout)
+	case err != nil:
+		return exitExec, fmt.Errorf("failed to run %s: %w", name, err)
+	case code != 0:
+		return code, fmt.Errorf("%s %w with exit code %d", name, errHookFailed, code)
+	}
+	return 0, nil
+}
+
+// runPostRun runs CDKTS_POST_RUN once deno has exited with code, which the
+// hook is given as CDKTS_EXIT_CODE, eg: to send a notification. It returns
+// the code the wrapper should exit with, which is deno's, unless the hook
+// could not be run at all after deno succeeded. A hook that fails is only
+// warned about, the stack has already been deployed, or not, regardless.
+func runPostRun(code int) int {
+	hookCode, err := runHook("CDKTS_POST_RUN", "CDKTS_EXIT_CODE="+strconv.Itoa(code))
+	switch {
+	case err == nil:
+		return code
+	case errors.Is(err, errHookFailed) || code != 0:
+		warnf("%v", err)
+		return code
+	}
+	return fail("post-run", hookCode, err)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestRunHook(t *testing.T) {
+	// Single quoted so a Windows path keeps its backslashes
+	helper := "'" + os.Args[0] + "' -test.run=TestHelperProcess"
+
+	tests := []struct {
+		name     string
+		hook     string
+		timeout  string
+		exitCode string
+		sleep    string
+		want     int
+		wantErr  bool
+	}{
+		{name: "unset", hook: "", want: 0},
+		{name: "success", hook: helper, want: 0},
+		{name: "failure", hook: helper, exitCode: "5", want: 5, wantErr: true},
+		{name: "timeout", hook: helper, timeout: "200ms", sleep: "1m", want: exitTimeout, wantErr: true},
+		{name: "missing", hook: "'" + filepath.Join(t.TempDir(), "missing") + "'", want: exitUsage, wantErr: true},
+		{name: "bad quoting", hook: "'" + os.Args[0], want: exitUsage, wantErr: true},
+		{name: "bad timeout", hook: helper, timeout: "soon", want: exitUsage, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GO_WANT_HELPER_PROCESS", "1")
+			t.Setenv("HELPER_EXIT_CODE", tt.exitCode)
+			t.Setenv("HELPER_SLEEP", tt.sleep)
+			t.Setenv("CDKTS_PRE_RUN", tt.hook)
+			t.Setenv("CDKTS_PRE_RUN_TIMEOUT", tt.timeout)
+
+			code, err := runHook("CDKTS_PRE_RUN")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runHook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if code != tt.want {
+				t.Errorf("runHook() = %d, want %d", code, tt.want)
+			}
+			if tt.sleep != "" && !errors.Is(err, errTimeout) {
+				t.Errorf("runHook() error = %v, want %v", err, errTimeout)
+			}
+		})
+	}
+}
+
+func TestRunPostRun(t *testing.T) {
+	helper := "'" + os.Args[0] + "' -test.run=TestHelperProcess"
+
+	tests := []struct {
+		name     string
+		hook     string
+		code     int
+		exitCode string
+		want     int
+		wantWarn bool
+	}{
+		{name: "unset", hook: "", code: 3, want: 3},
+		{name: "deno succeeded", hook: helper, code: 0, want: 0},
+		{name: "deno failed", hook: helper, code: 3, want: 3},
+		{name: "hook failed", hook: helper, code: 0, exitCode: "5", want: 0, wantWarn: true},
+		{name: "hook missing after success", hook: "'" + filepath.Join(t.TempDir(), "missing") + "'", code: 0, want: exitUsage, wantWarn: true},
+		{name: "hook missing after failure", hook: "'" + filepath.Join(t.TempDir(), "missing") + "'", code: 3, want: 3, wantWarn: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The hook exits 99 unless it's given deno's exit code
+			t.Setenv("GO_WANT_HELPER_PROCESS", "1")
+			t.Setenv("HELPER_ENV_NAME", "CDKTS_EXIT_CODE")
+			t.Setenv("HELPER_ENV_VALUE", strconv.Itoa(tt.code))
+			t.Setenv("HELPER_EXIT_CODE", tt.exitCode)
+			t.Setenv("CDKTS_POST_RUN", tt.hook)
+			t.Setenv("CDKTS_POST_RUN_TIMEOUT", "")
+
+			stderr := captureOutput(t, &os.Stderr)
+			if got := runPostRun(tt.code); got != tt.want {
+				t.Errorf("runPostRun(%d) = %d, want %d", tt.code, got, tt.want)
+			}
+			if warned := len(stderr()) > 0; warned != tt.wantWarn {
+				t.Errorf("runPostRun(%d) wrote %q to stderr, want output %t", tt.code, stderr(), tt.wantWarn)
+			}
+		})
+	}
+}
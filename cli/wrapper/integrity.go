@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// integrityHex converts a subresource integrity style sha256 hash, eg:
+// sha256-<base64>, into the hex digest deno records in its lock files.
+func integrityHex(integrity string) (string, error) {
+	digest, ok := strings.CutPrefix(integrity, "sha256-")
+	if !ok {
+		return "", fmt.Errorf("CDKTS_INTEGRITY %q must be of the form sha256-<base64>", integrity)
+	}
+	sum, err := base64.StdEncoding.DecodeString(digest)
+	if err != nil || len(sum) != 32 {
+		return "", fmt.Errorf("CDKTS_INTEGRITY %q is not a valid sha256 hash", integrity)
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+// integrityLock returns a minimal deno lock file that pins the JSR package of
+// the given CLI version to the hex digest of its version metadata. The
+// metadata lists the hash of every file in the package, so pinning it pins
+// the whole CLI.
+func integrityLock(version, digest string) ([]byte, error) {
+	pkg := "@brad-jones/cdkts@" + version
+	return json.MarshalIndent(map[string]any{
+		"version":    "5",
+		"specifiers": map[string]string{"jsr:" + pkg: version},
+		"jsr":        map[string]any{pkg: map[string]string{"integrity": digest}},
+	}, "", "  ")
+}
+
+// writeIntegrityLock writes the lock file for CDKTS_INTEGRITY to the temp dir
+// and returns its path. It's rewritten on every run so whatever deno adds to
+// it, or anything else does, can't weaken the pin.
+func writeIntegrityLock(integrity string) (string, error) {
+	if os.Getenv("CDKTS_LOCAL_MAIN") != "" {
+		return "", fmt.Errorf("CDKTS_INTEGRITY can not be used with CDKTS_LOCAL_MAIN")
+	}
+	digest, err := integrityHex(integrity)
+	if err != nil {
+		return "", err
+	}
+	version, err := cliVersion()
+	if err != nil {
+		return "", err
+	}
+	data, err := integrityLock(version, digest)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("cdkts-%s-%s.lock", version, digest[:12]))
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp.*")
+	if err != nil {
+		return "", fmt.Errorf("failed to write CDKTS_INTEGRITY lock file: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write CDKTS_INTEGRITY lock file: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIntegrityHex(t *testing.T) {
+	tests := []struct {
+		name      string
+		integrity string
+		want      string
+		wantErr   bool
+	}{
+		{"valid", "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", false},
+		{"hex", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", "", true},
+		{"other algorithm", "sha512-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", "", true},
+		{"bad base64", "sha256-not base64", "", true},
+		{"wrong length", "sha256-AAAA", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := integrityHex(tt.integrity)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("integrityHex() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("integrityHex() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteIntegrityLock(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	t.Setenv("TMP", dir)
+	t.Setenv("CDKTS_VERSION", "1.2.3")
+	t.Setenv("CDKTS_LOCAL_MAIN", "")
+
+	path, err := writeIntegrityLock("sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=")
+	if err != nil {
+		t.Fatalf("writeIntegrityLock() error = %v", err)
+	}
+	if filepath.Dir(path) != dir {
+		t.Errorf("writeIntegrityLock() = %q, want it in %q", path, dir)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lock struct {
+		Specifiers map[string]string `json:"specifiers"`
+		Jsr        map[string]struct {
+			Integrity string `json:"integrity"`
+		} `json:"jsr"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		t.Fatal(err)
+	}
+	if got := lock.Specifiers["jsr:@brad-jones/cdkts@1.2.3"]; got != "1.2.3" {
+		t.Errorf("specifier = %q, want 1.2.3", got)
+	}
+	if got := lock.Jsr["@brad-jones/cdkts@1.2.3"].Integrity; !strings.HasPrefix(got, "e3b0c442") {
+		t.Errorf("integrity = %q", got)
+	}
+
+	t.Setenv("CDKTS_LOCAL_MAIN", "./cli/main.ts")
+	if _, err := writeIntegrityLock("sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="); err == nil {
+		t.Error("writeIntegrityLock() expected an error with CDKTS_LOCAL_MAIN")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errLockTimeout = errors.New("timed out waiting for lock")
+
+// acquireLock takes an exclusive advisory lock on the file at path, creating it
+// if needed. If another process holds the lock we poll until it is released or
+// timeout elapses, so a wedged process can't hang the CLI forever.
+//
+// The OS releases the lock of a process that dies, but that can't be relied
+// on everywhere, eg: on a network share. So the holder records its PID in the
+// file and, once timeout elapses, a lock whose holder is gone is taken over.
+func acquireLock(path string, timeout time.Duration) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock file: %w", err)
+		}
+		if locked {
+			writeLockHolder(f)
+			return f, nil
+		}
+		if time.Now().After(deadline) {
+			pid, dead := lockHolderDead(f)
+			f.Close()
+			if dead {
+				warnf("taking over %s from PID %d which is no longer running", path, pid)
+				return stealLock(path)
+			}
+			if pid > 0 {
+				return nil, fmt.Errorf("%w held by PID %d", errLockTimeout, pid)
+			}
+			return nil, errLockTimeout
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// releaseLock unlocks and closes a lock file returned by acquireLock.
+func releaseLock(f *os.File) {
+	unlockFile(f)
+	f.Close()
+}
+
+// writeLockHolder records who holds the lock f, as "<pid> <hostname>".
+func writeLockHolder(f *os.File) {
+	host, _ := os.Hostname()
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(fmt.Sprintf("%d %s\n", os.Getpid(), host)), 0)
+	}
+}
+
+// parseLockHolder parses what writeLockHolder wrote.
+func parseLockHolder(data string) (int, string, bool) {
+	fields := strings.Fields(data)
+	if len(fields) != 2 {
+		return 0, "", false
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil || pid <= 0 {
+		return 0, "", false
+	}
+	return pid, fields[1], true
+}
+
+// lockHolderDead reads the PID of the holder of the lock f and reports
+// whether it has certainly exited. PIDs get reused, so a running process is
+// always assumed to be the holder, as is one on another host, which we can't
+// check. The worst that can happen then is waiting for a timeout again.
+func lockHolderDead(f *os.File) (int, bool) {
+	data := make([]byte, 256)
+	n, _ := f.ReadAt(data, 0)
+	pid, host, ok := parseLockHolder(string(data[:n]))
+	if !ok {
+		return 0, false
+	}
+	if ourHost, err := os.Hostname(); err != nil || host != ourHost {
+		return pid, false
+	}
+	return pid, pid != os.Getpid() && !processAlive(pid)
+}
+
+// stealLock replaces the lock file at path, whose holder is gone, with a new
+// one and locks that. Anyone still waiting on the old file keeps doing so
+// until they time out. Should two processes steal it at once they could
+// both proceed, which extraction tolerates as it's atomic.
+func stealLock(path string) (*os.File, error) {
+	os.Remove(path)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if locked, err := tryLockFile(f); err != nil || !locked {
+		f.Close()
+		return nil, errLockTimeout
+	}
+	writeLockHolder(f)
+	return f, nil
+}
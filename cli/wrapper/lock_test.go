@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+
+	lock, err := acquireLock(path, time.Second)
+	if err != nil {
+		t.Fatalf("acquireLock() error = %v", err)
+	}
+
+	if _, err := acquireLock(path, 100*time.Millisecond); !errors.Is(err, errLockTimeout) {
+		t.Fatalf("acquireLock() while held error = %v, want %v", err, errLockTimeout)
+	}
+
+	releaseLock(lock)
+
+	lock, err = acquireLock(path, time.Second)
+	if err != nil {
+		t.Fatalf("acquireLock() after release error = %v", err)
+	}
+	releaseLock(lock)
+}
+
+func TestParseLockHolder(t *testing.T) {
+	tests := []struct {
+		data string
+		pid  int
+		host string
+		ok   bool
+	}{
+		{"123 build-host\n", 123, "build-host", true},
+		{"", 0, "", false},
+		{"123\n", 0, "", false},
+		{"abc build-host\n", 0, "", false},
+		{"-1 build-host\n", 0, "", false},
+	}
+	for _, tt := range tests {
+		pid, host, ok := parseLockHolder(tt.data)
+		if pid != tt.pid || host != tt.host || ok != tt.ok {
+			t.Errorf("parseLockHolder(%q) = %d, %q, %t, want %d, %q, %t", tt.data, pid, host, ok, tt.pid, tt.host, tt.ok)
+		}
+	}
+}
+
+func TestAcquireLockStale(t *testing.T) {
+	// A process that has certainly exited
+	cmd := helperCommand(t, 0)
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	deadPID := cmd.Process.Pid
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		holder string
+		stolen bool
+	}{
+		{"dead holder", fmt.Sprintf("%d %s\n", deadPID, host), true},
+		{"running holder", fmt.Sprintf("%d %s\n", os.Getppid(), host), false},
+		{"other host", fmt.Sprintf("%d %s-other\n", deadPID, host), false},
+		{"unknown holder", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Stand in for a lock the OS failed to release when its holder died
+			path := filepath.Join(t.TempDir(), "test.lock")
+			held, err := acquireLock(path, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer releaseLock(held)
+			if err := os.WriteFile(path, []byte(tt.holder), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			lock, err := acquireLock(path, 100*time.Millisecond)
+			if tt.stolen {
+				if err != nil {
+					t.Fatalf("acquireLock() error = %v, want the lock to be taken over", err)
+				}
+				defer releaseLock(lock)
+				data, _ := os.ReadFile(path)
+				if want := fmt.Sprintf("%d %s\n", os.Getpid(), host); string(data) != want {
+					t.Errorf("lock holder = %q, want %q", data, want)
+				}
+				return
+			}
+			if !errors.Is(err, errLockTimeout) {
+				t.Fatalf("acquireLock() error = %v, want %v", err, errLockTimeout)
+			}
+			if tt.holder != "" && !strings.Contains(err.Error(), "held by PID") {
+				t.Errorf("acquireLock() error = %v, want the holder's PID", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ANSI SGR color codes used by the wrapper's own output.
+const (
+	ansiRed    = "31"
+	ansiGreen  = "32"
+	ansiYellow = "33"
+	ansiCyan   = "36"
+)
+
+// ciEnvVars are set by the common CI providers, CI alone covers most of them.
+var ciEnvVars = []string{"CI", "GITHUB_ACTIONS", "GITLAB_CI", "BUILDKITE", "TF_BUILD", "JENKINS_URL"}
+
+// debugf writes a diagnostic message to stderr when CDKTS_DEBUG is enabled.
+// It must never write to stdout as that may be consumed as plan/JSON output.
+func debugf(format string, args ...any) {
+	if !envBool("CDKTS_DEBUG") {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[cdkts-wrapper] "+format+"\n", args...)
+}
+
+// failure is how a fatal error is reported when CDKTS_ERROR_FORMAT=json.
+type failure struct {
+	Stage string `json:"stage"`
+	Error string `json:"error"`
+	Code  int    `json:"code"`
+}
+
+// fail reports a fatal wrapper error to stderr, returning the exit code the
+// wrapper should exit with. Every fatal error goes through here so automation
+// can set CDKTS_ERROR_FORMAT=json and get a single JSON object, naming the
+// stage that failed, instead of free text.
+func fail(stage string, code int, err error) int {
+	writeFailure(os.Stderr, os.Getenv("CDKTS_ERROR_FORMAT") == "json", stage, code, err)
+	return code
+}
+
+// writeFailure does the work of fail, writing to w.
+func writeFailure(w io.Writer, asJSON bool, stage string, code int, err error) {
+	if !asJSON {
+		printLabeled(w, colorEnabled(os.Stderr), "Error", ansiRed, "%v", err)
+		return
+	}
+	data, _ := json.Marshal(failure{stage, err.Error(), code})
+	fmt.Fprintf(w, "%s\n", data)
+}
+
+// warnf writes a warning message to stderr.
+func warnf(format string, args ...any) {
+	printLabeled(os.Stderr, colorEnabled(os.Stderr), "Warning", ansiYellow, format, args...)
+}
+
+// hintf writes a hint to stderr, unless CDKTS_NO_HINTS is set.
+func hintf(format string, args ...any) {
+	if envBool("CDKTS_NO_HINTS") {
+		return
+	}
+	printLabeled(os.Stderr, colorEnabled(os.Stderr), "Hint", ansiCyan, format, args...)
+}
+
+// printLabeled writes a single line message to w, prefixed with label which
+// is colored when color is set.
+func printLabeled(w io.Writer, color bool, label, code, format string, args ...any) {
+	fmt.Fprintf(w, "%s %s\n", colorize(color, code, label+":"), fmt.Sprintf(format, args...))
+}
+
+// colorize wraps s in the ANSI color code when color is set.
+func colorize(color bool, code, s string) string {
+	if !color {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[0m"
+}
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// isCI reports whether we look to be running in a CI pipeline.
+func isCI() bool {
+	for _, name := range ciEnvVars {
+		if value := os.Getenv(name); value != "" && value != "0" && value != "false" {
+			return true
+		}
+	}
+	return false
+}
+
+// colorEnabled reports whether ANSI colors may be written to f.
+func colorEnabled(f *os.File) bool {
+	return useColor(isTerminal(f))
+}
+
+// useColor decides whether to write ANSI colors to a terminal (or not),
+// honoring NO_COLOR, see https://no-color.org.
+func useColor(tty bool) bool {
+	return tty && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+}
+
+// useInteractive decides whether to show transient messages, such as
+// progress, on a terminal (or not). In CI or when debugging they would just
+// pollute the logs.
+func useInteractive(tty bool) bool {
+	return tty && !isCI() && !envBool("CDKTS_DEBUG")
+}
+
+// flushOutput makes sure everything the wrapper wrote has reached the
+// terminal or file behind stdout & stderr, which must be done before
+// syscall.Exec replaces the process, or it'd be lost along with it. Writes to
+// os.Stdout & os.Stderr are unbuffered, so this only has work to do when they
+// are files, pipes & terminals can't be synced and report an error we ignore.
+func flushOutput() {
+	os.Stdout.Sync()
+	os.Stderr.Sync()
+}
+
+// byteCounter is an io.Writer that discards what it's given, but reports how
+// much it's seen to out every step bytes, and as a percentage of total if
+// that's known (ie: > 0). It's for debugging slow extractions, so unlike
+// progress it writes lines that stay put.
+type byteCounter struct {
+	out     io.Writer
+	total   int64
+	step    int64
+	written int64
+	next    int64
+}
+
+// newByteCounter reports every tenth of total, or every 16MiB when it's unknown.
+func newByteCounter(out io.Writer, total int64) *byteCounter {
+	step := total / 10
+	if step <= 0 {
+		step = 16 << 20
+	}
+	return &byteCounter{out: out, total: total, step: step, next: step}
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.written += int64(len(p))
+	if c.written >= c.next {
+		for c.next <= c.written {
+			c.next += c.step
+		}
+		if c.total > 0 {
+			fmt.Fprintf(c.out, "[cdkts-wrapper] extracted %d of %d bytes (%d%%)\n", c.written, c.total, c.written*100/c.total)
+		} else {
+			fmt.Fprintf(c.out, "[cdkts-wrapper] extracted %d bytes\n", c.written)
+		}
+	}
+	return len(p), nil
+}
+
+// progress prints a transient status message to stderr, returning a func that
+// clears it again. It's a no-op unless useInteractive allows it.
+func progress(msg string) func() {
+	if !useInteractive(isTerminal(os.Stderr)) {
+		return func() {}
+	}
+	fmt.Fprint(os.Stderr, msg)
+	return func() {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// clearCIEnv unsets every CI marker, in case the tests themselves run in CI.
+func clearCIEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range ciEnvVars {
+		t.Setenv(name, "")
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	tests := []struct {
+		name    string
+		tty     bool
+		noColor string
+		term    string
+		want    bool
+	}{
+		{"terminal", true, "", "xterm", true},
+		{"not a terminal", false, "", "xterm", false},
+		{"NO_COLOR", true, "1", "xterm", false},
+		{"dumb terminal", true, "", "dumb", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			t.Setenv("TERM", tt.term)
+			if got := useColor(tt.tty); got != tt.want {
+				t.Errorf("useColor(%v) = %v, want %v", tt.tty, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUseInteractive(t *testing.T) {
+	tests := []struct {
+		name string
+		tty  bool
+		env  map[string]string
+		want bool
+	}{
+		{"terminal", true, nil, true},
+		{"not a terminal", false, nil, false},
+		{"CI", true, map[string]string{"CI": "true"}, false},
+		{"CI false", true, map[string]string{"CI": "false"}, true},
+		{"GitHub Actions", true, map[string]string{"GITHUB_ACTIONS": "true"}, false},
+		{"debug", true, map[string]string{"CDKTS_DEBUG": "1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearCIEnv(t)
+			t.Setenv("CDKTS_DEBUG", "")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			if got := useInteractive(tt.tty); got != tt.want {
+				t.Errorf("useInteractive(%v) = %v, want %v", tt.tty, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintLabeled(t *testing.T) {
+	tests := []struct {
+		name  string
+		color bool
+		want  string
+	}{
+		{"plain", false, "Warning: 100% broken\n"},
+		{"color", true, "\033[33mWarning:\033[0m 100% broken\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			printLabeled(&buf, tt.color, "Warning", ansiYellow, "%d%% %s", 100, "broken")
+			if got := buf.String(); got != tt.want {
+				t.Errorf("printLabeled() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Hints printed just before syscall.Exec must already be in the file stderr
+// is redirected to, and a pipe, which can't be synced, must not upset it.
+func TestFlushOutput(t *testing.T) {
+	original := os.Stderr
+	t.Cleanup(func() { os.Stderr = original })
+	t.Setenv("CDKTS_NO_HINTS", "")
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	os.Stderr = f
+	hintf("before exec")
+	flushOutput()
+	if got, err := os.ReadFile(f.Name()); err != nil || string(got) != "Hint: before exec\n" {
+		t.Errorf("stderr = %q, %v, want %q", got, err, "Hint: before exec\n")
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	os.Stderr = w
+	flushOutput()
+}
+
+func TestByteCounter(t *testing.T) {
+	tests := []struct {
+		name   string
+		total  int64
+		writes []int
+		want   []string
+	}{
+		{"known size", 100, []int{5, 5, 25, 65}, []string{"10 of 100 bytes (10%)", "35 of 100 bytes (35%)", "100 of 100 bytes (100%)"}},
+		{"unknown size", 0, []int{16 << 20, 1, 16 << 20}, []string{"extracted 16777216 bytes", "extracted 33554433 bytes"}},
+		{"too little to report", 100, []int{9}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			counter := newByteCounter(&out, tt.total)
+			for _, size := range tt.writes {
+				if n, err := counter.Write(make([]byte, size)); n != size || err != nil {
+					t.Fatalf("Write() = %d, %v, want %d, nil", n, err, size)
+				}
+			}
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if tt.want == nil {
+				if out.Len() != 0 {
+					t.Fatalf("output = %q, want nothing", out.String())
+				}
+				return
+			}
+			if len(lines) != len(tt.want) {
+				t.Fatalf("output = %q, want %d lines", out.String(), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(lines[i], want) {
+					t.Errorf("line %d = %q, want it to contain %q", i, lines[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFailure(t *testing.T) {
+	err := errors.New(`CDKTS_TIMEOUT "soon" is invalid`)
+
+	var text bytes.Buffer
+	writeFailure(&text, false, "timeout", exitUsage, err)
+	if want := "Error: CDKTS_TIMEOUT \"soon\" is invalid\n"; text.String() != want {
+		t.Errorf("writeFailure() = %q, want %q", text.String(), want)
+	}
+
+	var out bytes.Buffer
+	writeFailure(&out, true, "timeout", exitUsage, err)
+	var got failure
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("writeFailure() = %q, not JSON: %v", out.String(), err)
+	}
+	if want := (failure{"timeout", err.Error(), exitUsage}); got != want {
+		t.Errorf("writeFailure() = %+v, want %+v", got, want)
+	}
+}
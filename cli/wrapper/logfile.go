@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// openLogFile opens CDKTS_LOG_FILE, if it's set, for runBinary to copy the
+// child's output to. It's opened for appending, so that if something like
+// logrotate's copytruncate empties it while we're running, we carry on
+// writing at the new end of the file rather than leaving a hole of NULs.
+func openLogFile() (*os.File, error) {
+	path := os.Getenv("CDKTS_LOG_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CDKTS_LOG_FILE: %w", err)
+	}
+	return f, nil
+}
+
+// closeLogFile makes sure everything written to f has reached the disk before
+// closing it, the log is most wanted when something went wrong after all.
+func closeLogFile(f *os.File) {
+	if err := f.Sync(); err != nil {
+		debugf("failed to sync CDKTS_LOG_FILE: %v", err)
+	}
+	f.Close()
+}
+
+// teeOutput returns where the child's stdout & stderr should be written,
+// which is ours, and f too if it's non nil.
+func teeOutput(f *os.File) (io.Writer, io.Writer) {
+	if f == nil {
+		return os.Stdout, os.Stderr
+	}
+	return io.MultiWriter(os.Stdout, f), io.MultiWriter(os.Stderr, f)
+}
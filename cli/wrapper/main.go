@@ -1,119 +1,459 @@
 package main
 
 import (
-	"bytes"
-	"compress/gzip"
-	"crypto/sha256"
-	_ "embed"
+	"errors"
 	"fmt"
-	"io"
+	"net/http"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"runtime"
-	"syscall"
+	"slices"
+	"strings"
+	"time"
 )
 
-//go:embed deno.gz
-var denoGzippedBytes []byte
-
 // This will be replaced by the build script
 var cdkTsVersion = "0.8.0"
 
-func sha256Sum(data []byte) string {
-	hash := sha256.Sum256(data)
-	return fmt.Sprintf("%x", hash)
-}
+// Exit codes for the wrapper's own failures, from sysexits.h, so automation
+// can tell them apart from each other and from a failed stack. Deno's own exit
+// code is passed through as is, see also exitTimeout.
+const (
+	// The configuration is invalid, eg: a bad CDKTS_* variable or .cdktsrc
+	exitUsage = 64
+	// The embedded deno is broken or couldn't be extracted
+	exitExtract = 70
+	// Deno couldn't be started
+	exitExec = 71
+)
 
-func extractDeno(path string) error {
-	// Create the output file
-	outFile, err := os.Create(path)
+// checkExecutable returns an error if path is not an executable file.
+func checkExecutable(path string) error {
+	info, err := os.Stat(path)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("%s is not executable", path)
+	}
+	return nil
+}
+
+// hasWrapperFlag reports whether flag appears in args before any "--"
+// separator, everything after that belongs to tofu/terraform.
+func hasWrapperFlag(args []string, flag string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		if arg == flag {
+			return true
+		}
 	}
+	return false
+}
 
-	// Create gzip reader
-	reader, err := gzip.NewReader(bytes.NewReader(denoGzippedBytes))
+// removeWrapperFlag returns args without any occurrence of flag before the
+// "--" separator, along with whether it was found. Wrapper only flags must be
+// removed before the args are handed to the CLI, which doesn't know them.
+func removeWrapperFlag(args []string, flag string) ([]string, bool) {
+	result := make([]string, 0, len(args))
+	found := false
+	for i, arg := range args {
+		if arg == "--" {
+			result = append(result, args[i:]...)
+			break
+		}
+		if arg == flag {
+			found = true
+			continue
+		}
+		result = append(result, arg)
+	}
+	return result, found
+}
+
+// removeWrapperValueFlag is removeWrapperFlag for a flag that takes a value,
+// either as the next arg or attached with "=". The last value given wins.
+func removeWrapperValueFlag(args []string, flag string) ([]string, string, bool, error) {
+	result := make([]string, 0, len(args))
+	value := ""
+	found := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			result = append(result, args[i:]...)
+			break
+		}
+		if v, ok := strings.CutPrefix(arg, flag+"="); ok {
+			value, found = v, true
+			continue
+		}
+		if arg == flag {
+			if i+1 >= len(args) || args[i+1] == "--" {
+				return nil, "", false, fmt.Errorf("%s requires a value", flag)
+			}
+			value, found = args[i+1], true
+			i++
+			continue
+		}
+		result = append(result, arg)
+	}
+	return result, value, found, nil
+}
+
+// applyChdir changes to the dir given by --wrapper-chdir, or CDKTS_CHDIR, as
+// if cdkts had been started there, like git -C. Everything relative, be it
+// the stack path, .cdktsrc discovery or CDKTS_PROJECT_DIR, is then relative
+// to it. The flag is removed from the returned args.
+func applyChdir(args []string) ([]string, error) {
+	args, dir, found, err := removeWrapperValueFlag(args, "--wrapper-chdir")
 	if err != nil {
-		outFile.Close()
-		return fmt.Errorf("failed to create gzip reader: %w", err)
+		return nil, err
+	}
+	if !found {
+		dir = os.Getenv("CDKTS_CHDIR")
+	} else if dir == "" {
+		return nil, errors.New("--wrapper-chdir requires a value")
+	}
+	if dir == "" {
+		return args, nil
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("unable to change to %s: %w", dir, err)
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("unable to change to %s: not a directory", dir)
+	}
+	if err := os.Chdir(dir); err != nil {
+		return nil, fmt.Errorf("unable to change to %s: %w", dir, err)
 	}
-	defer reader.Close()
+	debugf("changed dir to %s", dir)
+	return args, nil
+}
 
-	// Stream decompressed data directly to file
-	if _, err := io.Copy(outFile, reader); err != nil {
-		outFile.Close()
-		return fmt.Errorf("failed to decompress and write data: %w", err)
+// denoExtraFlags parses CDKTS_DENO_FLAGS, extra deno runtime flags such as
+// --v8-flags or --unstable-*, using shell like quoting. Every token must be a
+// flag, so flag values must be attached with "=", eg: --seed=1. This prevents
+// the variable from being used to run a different script.
+func denoExtraFlags() ([]string, error) {
+	flags, err := shellSplit(os.Getenv("CDKTS_DENO_FLAGS"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CDKTS_DENO_FLAGS: %w", err)
+	}
+	for _, flag := range flags {
+		if !strings.HasPrefix(flag, "-") {
+			return nil, fmt.Errorf("CDKTS_DENO_FLAGS may only contain flags, got %q", flag)
+		}
 	}
+	return flags, nil
+}
 
-	// Close the file before setting permissions
-	if err := outFile.Close(); err != nil {
-		return fmt.Errorf("failed to close file: %w", err)
+// denoRunArgs builds the deno command line that runs the CLI at specifier.
+// Deno's own flags must come before the specifier, everything after it is
+// passed to the CLI as is.
+//
+// The order is: permissions, wrapper controlled flags, CDKTS_DENO_FLAGS.
+func denoRunArgs(specifier string, cliArgs []string) ([]string, error) {
+	permissions, err := denoPermissions()
+	if err != nil {
+		return nil, err
 	}
 
-	// Set appropriate permissions
-	perm := os.FileMode(0644)
-	if runtime.GOOS != "windows" {
-		perm = 0755
+	extraFlags, err := denoExtraFlags()
+	if err != nil {
+		return nil, err
 	}
 
-	if err := os.Chmod(path, perm); err != nil {
-		return fmt.Errorf("failed to set file permissions: %w", err)
+	lock, err := lockArgs()
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	args := append([]string{"run", "-q"}, permissions...)
+	if envBool("CDKTS_OFFLINE") {
+		// Fail fast instead of reaching out to JSR
+		args = append(args, "--cached-only")
+	}
+	args = append(args, lock...)
+	args = append(args, extraFlags...)
+	args = append(args, specifier)
+	return append(args, cliArgs...), nil
 }
 
-// execBinary executes the binary at the given path with the provided arguments.
-// On Unix systems, it uses syscall.Exec to replace the current process.
-// On Windows, syscall.Exec is not available, so we use exec.Command.
-func execBinary(binaryPath string, args []string) error {
-	if runtime.GOOS != "windows" {
-		argv := append([]string{binaryPath}, args...)
-		if err := syscall.Exec(binaryPath, argv, os.Environ()); err != nil {
-			return fmt.Errorf("error running binary: %w", err)
-		}
-		return nil
+// denoFetchFlags are the CDKTS_DENO_FLAGS that change how deno fetches
+// modules, eg: to trust a corporate CA, the rest only matter to deno run.
+var denoFetchFlags = []string{"--cert", "--unsafely-ignore-certificate-errors", "--import-map", "--reload"}
+
+// denoCacheArgs builds the deno command line that fetches the CLI at specifier
+// and all of its dependencies into deno's cache without running it.
+func denoCacheArgs(specifier string) ([]string, error) {
+	extraFlags, err := denoExtraFlags()
+	if err != nil {
+		return nil, err
 	}
 
-	cmd := exec.Command(binaryPath, args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	lock, err := lockArgs()
+	if err != nil {
+		return nil, err
+	}
 
-	if err := cmd.Run(); err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			os.Exit(exitErr.ExitCode())
+	args := append([]string{"cache", "-q"}, lock...)
+	for _, flag := range extraFlags {
+		if name, _, _ := strings.Cut(flag, "="); slices.Contains(denoFetchFlags, name) {
+			args = append(args, flag)
 		}
-		return fmt.Errorf("error running binary: %w", err)
 	}
+	return append(args, specifier), nil
+}
 
+// printVersion prints the wrapper, CLI & embedded deno versions.
+func printVersion() error {
+	specifier, err := cliSpecifier()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrapper: %s\n", cdkTsVersion)
+	fmt.Printf("cli:     %s\n", specifier)
+	fmt.Printf("deno:    %s\n", embeddedDenoVersion())
+	return nil
+}
+
+// printDenoPath reports which deno binary the wrapper resolved, for debugging.
+func printDenoPath(denoPath string, extracted bool) error {
+	sum, err := fileSha256(denoPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("path:      %s\n", denoPath)
+	fmt.Printf("extracted: %t\n", extracted)
+	fmt.Printf("sha256:    %s\n", sum)
 	return nil
 }
 
 func main() {
-	// Build a unique path for the embedded Deno binary based on its content hash
-	exeSuffix := ""
-	if runtime.GOOS == "windows" {
-		exeSuffix = ".exe"
+	os.Exit(run())
+}
+
+// run does the work of main, returning the exit code rather than calling
+// os.Exit itself so that deferred cleanup always happens.
+func run() int {
+	// Response files are relative to where cdkts was started, so come first.
+	// Everything below reads os.Args, so they're expanded in there.
+	rest, err := expandResponseFiles(os.Args[1:])
+	if err != nil {
+		return fail("response-file", exitUsage, err)
 	}
-	denoPath := fmt.Sprintf("%s/cdkts-embedded-%s%s", os.TempDir(), sha256Sum(denoGzippedBytes), exeSuffix)
 
-	// Check if the file already exists and is valid before writing it again
-	if _, err := os.Stat(denoPath); os.IsNotExist(err) {
-		// If not found, write the gzipped bytes to the file and decompress it
-		if err := extractDeno(denoPath); err != nil {
-			fmt.Fprintf(os.Stderr, "Error extracting deno: %v\n", err)
-			os.Exit(1)
+	// Must come next as it changes where everything else is relative to.
+	// The flag is removed from os.Args too.
+	rest, err = applyChdir(rest)
+	if err != nil {
+		return fail("chdir", exitUsage, err)
+	}
+	os.Args = append(os.Args[:1], rest...)
+
+	// Defaults from .cdktsrc files, everything below reads the environment
+	if err := applyRcFiles(); err != nil {
+		return fail("rc", exitUsage, err)
+	}
+
+	// Document the wrapper's own knobs, --help is left for the CLI
+	if len(os.Args) > 1 && os.Args[1] == "wrapper-help" {
+		printHelp(os.Stdout)
+		return 0
+	}
+
+	// Validate the toolchain instead of running the CLI
+	if len(os.Args) > 1 && os.Args[1] == "wrapper-doctor" {
+		return runDoctor()
+	}
+
+	// Recover from a corrupt cache by removing everything we extracted
+	if len(os.Args) > 1 && os.Args[1] == "wrapper-clean-cache" {
+		return runCleanCache()
+	}
+
+	// Report our versions, only when it's the very first arg so that we don't
+	// swallow a --version meant for a subcommand or tofu/terraform.
+	if len(os.Args) > 1 && (os.Args[1] == "--version" || os.Args[1] == "-V") {
+		if err := printVersion(); err != nil {
+			return fail("version", exitUsage, err)
+		}
+		return 0
+	}
+
+	// Report the bundled deno version without having to extract or run it
+	if hasWrapperFlag(os.Args[1:], "--deno-version") {
+		fmt.Println(embeddedDenoVersion())
+		return 0
+	}
+
+	// Allow an externally managed deno to be used instead of the embedded one
+	denoPath := os.Getenv("CDKTS_DENO_PATH")
+	extracted := false
+	supervise := false
+	// Only a deno we extracted is ours to replace, never the user's own
+	owned := false
+	if denoPath != "" {
+		if err := checkExecutable(denoPath); err != nil {
+			return fail("deno-path", exitUsage, fmt.Errorf("CDKTS_DENO_PATH is invalid: %w", err))
+		}
+	} else if path, ok := versionFileDeno(); ok {
+		// The project pins its own deno, which asdf or mise already installed
+		denoPath = path
+	} else if path, ok := systemDeno(); ok {
+		// No need to extract our own copy of the exact same deno
+		denoPath = path
+	} else {
+		owned = true
+		if err := checkEmbeddedDeno(); err != nil {
+			reportFailure("embed")
+			return fail("embed", exitExtract, err)
+		}
+		if err := checkDenoTarget(); err != nil {
+			reportFailure("target")
+			return fail("target", exitExtract, err)
+		}
+		var err error
+		if envBool("CDKTS_NO_CACHE") {
+			// Nothing may be left on disk, so we have to outlive deno to clean up
+			var cleanup func()
+			if denoPath, cleanup, err = extractTempDeno(); err != nil {
+				reportFailure("extract")
+				return fail("extract", exitExtract, fmt.Errorf("failed to extract deno: %w", err))
+			}
+			defer cleanup()
+			extracted = true
+			supervise = true
+		} else if denoPath, extracted, err = ensureEmbeddedDeno(); err != nil {
+			reportFailure("extract")
+			return fail("extract", exitExtract, fmt.Errorf("failed to extract deno: %w", err))
+		}
+	}
+
+	debugf("deno path: %s (extracted: %t)", denoPath, extracted)
+
+	if hasWrapperFlag(os.Args[1:], "--print-deno-path") {
+		if err := printDenoPath(denoPath, extracted); err != nil {
+			return fail("print-deno-path", exitExtract, err)
+		}
+		return 0
+	}
+
+	// Dump what we resolved for support tooling, only the dump goes to stdout
+	if len(os.Args) > 1 && os.Args[1] == "wrapper-env" {
+		env, err := newWrapperEnv(denoPath, extracted)
+		if err == nil {
+			err = printWrapperEnv(env, hasWrapperFlag(os.Args[2:], "--json"))
+		}
+		if err != nil {
+			return fail("wrapper-env", exitUsage, err)
+		}
+		return 0
+	}
+
+	if runningTranslated() {
+		hintf("cdkts is running under Rosetta which is slow, install the darwin aarch64 build instead")
+	}
+
+	// Resolve which CLI to run
+	specifier, err := cliSpecifier()
+	if err != nil {
+		return fail("specifier", exitUsage, err)
+	}
+
+	// The first run of each CLI version is when deno has to fetch it from JSR,
+	// so check the version exists, to catch a typo in CDKTS_VERSION before deno
+	// fails with a raw 404, and point users behind a corporate proxy in the
+	// right direction. Once it's been found later runs skip the round trip.
+	applyProxyEnv()
+	applyRegistryEnv()
+	if err := applyDenoDirEnv(); err != nil {
+		return fail("deno-dir", exitUsage, err)
+	}
+	if !envBool("CDKTS_NO_NET_CHECK") && !envBool("CDKTS_OFFLINE") && os.Getenv("CDKTS_LOCAL_MAIN") == "" {
+		// Both have already been validated by cliSpecifier
+		base, _ := registryBase()
+		version, _ := cliVersion()
+		// A deno we extracted is in a dir we know we can write to
+		markerDir := cacheDirs()[0]
+		if owned {
+			markerDir = filepath.Dir(denoPath)
+		}
+		if err := checkRegistry(&http.Client{Timeout: 3 * time.Second}, base, version, markerDir, extracted); err != nil {
+			return fail("published", exitUsage, err)
 		}
 	}
 
 	// Build the argument list for Deno
-	args := []string{"run", "-qA", fmt.Sprintf("jsr:@brad-jones/cdkts@%s/cli", cdkTsVersion)}
-	args = append(args, os.Args[1:]...)
+	cliArgs, dryRun := removeWrapperFlag(os.Args[1:], "--wrapper-dry-run")
+	var args []string
+	if len(cliArgs) > 0 && cliArgs[0] == "wrapper-prefetch" {
+		// Warm the caches, eg: in CI, so later runs are fast & can be offline.
+		// Deno has already been extracted above, so all that's left is the CLI.
+		args, err = denoCacheArgs(specifier)
+	} else if cliArgs, err = withDefaultFlags(cliArgs); err == nil {
+		args, err = denoRunArgs(specifier, cliArgs)
+	}
+	if err != nil {
+		return fail("args", exitUsage, err)
+	}
+
+	debugf("cli specifier: %s", specifier)
+	debugf("deno argv: %q", args)
 
-	// Execute deno with the original arguments (excluding the wrapper itself)
-	if err := execBinary(denoPath, args); err != nil {
-		fmt.Fprintf(os.Stderr, "Error running deno: %v\n", err)
-		os.Exit(1)
+	// Show what would be run, in a form that can be pasted into a shell
+	if dryRun || envBool("CDKTS_DRY_RUN") {
+		fmt.Println(shellJoin(append([]string{denoPath}, args...)))
+		return 0
+	}
+
+	// Execute deno with the original arguments (excluding the wrapper itself).
+	// A timeout can only be enforced, and a pseudo terminal only be read, if we
+	// outlive deno, so then it runs as a child, see launchDeno.
+	timeout, err := childTimeout()
+	if err != nil {
+		return fail("timeout", exitUsage, err)
+	}
+
+	// Eg: refresh cloud credentials, it has to happen before deno replaces us
+	if code, err := runHook("CDKTS_PRE_RUN"); err != nil {
+		return fail("pre-run", code, err)
+	}
+
+	launch := func() (int, error) {
+		return launchDeno(denoPath, args, supervise, timeout)
+	}
+	var reextract func() error
+	if owned {
+		reextract = func() error { return reextractDeno(denoPath) }
+	}
+	code, err := retryQuarantined(launch, reextract)
+	if err == nil || errors.Is(err, errTimeout) {
+		// Deno ran, as a child, so we're still here to follow it up
+		code = runPostRun(code)
+	}
+	if err != nil {
+		if errors.Is(err, errTimeout) {
+			// The stack took too long, not something for us to fix
+			return fail("exec", code, err)
+		}
+		// Hints come first, so the failure is the last line, which for
+		// CDKTS_ERROR_FORMAT=json is all automation has to look at
+		switch {
+		case errors.Is(err, errExecFormat):
+			hintf("%s can not run on this machine (%s), check you installed the right cdkts build", denoPath, embeddedDenoTarget())
+			reportFailure("exec-format")
+		case owned && isQuarantined(err):
+			hintf("something, usually antivirus, removed or locked %s after it was extracted, consider adding an exclusion for %s", denoPath, filepath.Dir(denoPath))
+			reportFailure("quarantined")
+		default:
+			reportFailure("exec")
+		}
+		return fail("exec", exitExec, err)
 	}
+	return code
 }
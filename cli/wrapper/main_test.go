@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestHasWrapperFlag(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"only arg", []string{"--print-deno-path"}, true},
+		{"before subcommand", []string{"--print-deno-path", "plan", "./stack.ts"}, true},
+		{"after subcommand", []string{"plan", "--print-deno-path"}, true},
+		{"after separator", []string{"plan", "./stack.ts", "--", "--print-deno-path"}, false},
+		{"absent", []string{"plan", "./stack.ts"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasWrapperFlag(tt.args, "--print-deno-path"); got != tt.want {
+				t.Errorf("hasWrapperFlag() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenoRunArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		offline string
+		want    []string
+	}{
+		{"online", "", []string{"run", "-q", "-A", "jsr:cli", "plan", "./stack.ts", "--", "-var=a"}},
+		{"offline", "1", []string{"run", "-q", "-A", "--cached-only", "jsr:cli", "plan", "./stack.ts", "--", "-var=a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CDKTS_OFFLINE", tt.offline)
+			got, err := denoRunArgs("jsr:cli", []string{"plan", "./stack.ts", "--", "-var=a"})
+			if err != nil {
+				t.Fatalf("denoRunArgs() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("denoRunArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenoCacheArgs(t *testing.T) {
+	lockFile := filepath.Join(t.TempDir(), "deno.lock")
+	if err := os.WriteFile(lockFile, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		lock  string
+		flags string
+		want  []string
+	}{
+		{"no lock", "", "", []string{"cache", "-q", "jsr:cli"}},
+		{"lock", lockFile, "", []string{"cache", "-q", "--lock=" + lockFile, "--frozen", "jsr:cli"}},
+		// Only the flags that affect fetching, deno cache rejects the others
+		{"deno flags", "", "--seed=1 --cert=/ca.pem --unsafely-ignore-certificate-errors", []string{"cache", "-q", "--cert=/ca.pem", "--unsafely-ignore-certificate-errors", "jsr:cli"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CDKTS_LOCK", tt.lock)
+			t.Setenv("CDKTS_DENO_FLAGS", tt.flags)
+			got, err := denoCacheArgs("jsr:cli")
+			if err != nil {
+				t.Fatalf("denoCacheArgs() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("denoCacheArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveWrapperFlag(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		want      []string
+		wantFound bool
+	}{
+		{"absent", []string{"plan", "./stack.ts"}, []string{"plan", "./stack.ts"}, false},
+		{"first", []string{"--wrapper-dry-run", "plan", "./stack.ts"}, []string{"plan", "./stack.ts"}, true},
+		{"last", []string{"plan", "./stack.ts", "--wrapper-dry-run"}, []string{"plan", "./stack.ts"}, true},
+		{"after separator", []string{"plan", "--", "--wrapper-dry-run"}, []string{"plan", "--", "--wrapper-dry-run"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := removeWrapperFlag(tt.args, "--wrapper-dry-run")
+			if !slices.Equal(got, tt.want) || found != tt.wantFound {
+				t.Errorf("removeWrapperFlag() = %q, %v, want %q, %v", got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestDenoExtraFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		want    []string
+		wantErr bool
+	}{
+		{"unset", "", nil, false},
+		{"flags", `--seed=1 --v8-flags="--max-old-space-size=4096"`, []string{"--seed=1", "--v8-flags=--max-old-space-size=4096"}, false},
+		{"detached value", "--seed 1", nil, true},
+		{"script", "https://evil.com/main.ts", nil, true},
+		{"bad quoting", `--v8-flags="oops`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CDKTS_DENO_FLAGS", tt.env)
+			got, err := denoExtraFlags()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("denoExtraFlags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("denoExtraFlags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("position", func(t *testing.T) {
+		t.Setenv("CDKTS_DENO_FLAGS", "--seed=1")
+		got, err := denoRunArgs("jsr:cli", []string{"plan"})
+		if err != nil {
+			t.Fatalf("denoRunArgs() error = %v", err)
+		}
+		if want := []string{"run", "-q", "-A", "--seed=1", "jsr:cli", "plan"}; !slices.Equal(got, want) {
+			t.Errorf("denoRunArgs() = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestRunExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	notDeno := filepath.Join(dir, "not-deno")
+	if err := os.WriteFile(notDeno, []byte("not an executable"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	badRc := filepath.Join(dir, "bad-rc")
+	if err := os.MkdirAll(badRc, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(badRc, rcFileName), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cwd    string
+		env    map[string]string
+		target string
+		want   int
+		stage  string
+	}{
+		{"bad rc file", badRc, nil, "", exitUsage, "rc"},
+		{"bad CDKTS_DENO_PATH", dir, map[string]string{"CDKTS_DENO_PATH": filepath.Join(dir, "missing")}, "", exitUsage, "deno-path"},
+		{"bad CDKTS_TIMEOUT", dir, map[string]string{"CDKTS_DENO_PATH": notDeno, "CDKTS_TIMEOUT": "soon"}, "", exitUsage, "timeout"},
+		{"bad CDKTS_DENO_FLAGS", dir, map[string]string{"CDKTS_DENO_PATH": notDeno, "CDKTS_DENO_FLAGS": "script.ts"}, "", exitUsage, "args"},
+		{"deno for another platform", dir, nil, "plan9/mips", exitExtract, "target"},
+		// Run as a child, via the timeout, so a successful exec can't replace the test
+		{"deno fails to start", dir, map[string]string{"CDKTS_DENO_PATH": notDeno, "CDKTS_TIMEOUT": "1m"}, "", exitExec, "exec"},
+		{"deno fails to start with a hint", dir, map[string]string{"CDKTS_DENO_PATH": notDeno, "CDKTS_TIMEOUT": "1m", "CDKTS_NO_HINTS": ""}, "", exitExec, "exec"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(tt.cwd)
+			t.Setenv("HOME", dir)
+			t.Setenv("USERPROFILE", dir)
+			t.Setenv("CDKTS_PREFER_SYSTEM_DENO", "")
+			t.Setenv("CDKTS_USE_VERSION_FILE", "")
+			t.Setenv("CDKTS_NO_HINTS", "1")
+			t.Setenv("CDKTS_NO_NET_CHECK", "1")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			if tt.target != "" {
+				original := denoTarget
+				t.Cleanup(func() { denoTarget = original })
+				denoTarget = tt.target
+			}
+			originalArgs := os.Args
+			t.Cleanup(func() { os.Args = originalArgs })
+			os.Args = []string{"cdkts", "plan", "./stack.ts"}
+
+			if got := run(); got != tt.want {
+				t.Errorf("run() = %d, want %d", got, tt.want)
+			}
+
+			// The same failure again, as JSON for automation
+			t.Setenv("CDKTS_ERROR_FORMAT", "json")
+			stderr := captureOutput(t, &os.Stderr)
+			os.Args = []string{"cdkts", "plan", "./stack.ts"}
+			run()
+			// Warnings are still text, the failure is always the last line
+			lines := bytes.Split(bytes.TrimSpace(stderr()), []byte("\n"))
+			var got failure
+			if err := json.Unmarshal(lines[len(lines)-1], &got); err != nil {
+				t.Fatalf("stderr is not a JSON failure: %v", err)
+			}
+			if got.Stage != tt.stage || got.Code != tt.want || got.Error == "" {
+				t.Errorf("failure = %+v, want stage %q & code %d", got, tt.stage, tt.want)
+			}
+		})
+	}
+}
+
+// captureOutput redirects std, ie: os.Stdout or os.Stderr, to a file for the
+// rest of the test, returning a func that reads everything written to it so
+// far.
+func captureOutput(t *testing.T, std **os.File) func() []byte {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := *std
+	*std = f
+	t.Cleanup(func() {
+		*std = original
+		f.Close()
+	})
+	return func() []byte {
+		data, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+}
+
+func TestRemoveWrapperValueFlag(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		value   string
+		found   bool
+		wantErr bool
+	}{
+		{"separate value", []string{"--wrapper-chdir", "infra", "plan"}, []string{"plan"}, "infra", true, false},
+		{"attached value", []string{"plan", "--wrapper-chdir=infra"}, []string{"plan"}, "infra", true, false},
+		{"last wins", []string{"--wrapper-chdir=a", "--wrapper-chdir", "b", "plan"}, []string{"plan"}, "b", true, false},
+		{"after separator", []string{"plan", "--", "--wrapper-chdir", "infra"}, []string{"plan", "--", "--wrapper-chdir", "infra"}, "", false, false},
+		{"absent", []string{"plan"}, []string{"plan"}, "", false, false},
+		{"missing value", []string{"plan", "--wrapper-chdir"}, nil, "", false, true},
+		{"value is separator", []string{"--wrapper-chdir", "--", "x"}, nil, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, value, found, err := removeWrapperValueFlag(tt.args, "--wrapper-chdir")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("removeWrapperValueFlag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) || value != tt.value || found != tt.found {
+				t.Errorf("removeWrapperValueFlag() = %q, %q, %t, want %q, %q, %t", got, value, found, tt.want, tt.value, tt.found)
+			}
+		})
+	}
+}
+
+func TestApplyChdir(t *testing.T) {
+	base := t.TempDir()
+	infra := filepath.Join(base, "infra")
+	other := filepath.Join(base, "other")
+	for _, dir := range []string{infra, other} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := filepath.Join(base, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		env     string
+		args    []string
+		want    []string
+		wantDir string
+		wantErr bool
+	}{
+		{"flag", "", []string{"--wrapper-chdir", "infra", "plan", "stack.ts"}, []string{"plan", "stack.ts"}, infra, false},
+		{"env", "infra", []string{"plan", "stack.ts"}, []string{"plan", "stack.ts"}, infra, false},
+		{"flag overrides env", "other", []string{"plan", "--wrapper-chdir=infra"}, []string{"plan"}, infra, false},
+		{"neither", "", []string{"plan"}, []string{"plan"}, base, false},
+		{"missing dir", "", []string{"--wrapper-chdir", "missing", "plan"}, nil, base, true},
+		{"not a dir", "", []string{"--wrapper-chdir", file, "plan"}, nil, base, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(base)
+			t.Setenv("CDKTS_CHDIR", tt.env)
+
+			got, err := applyChdir(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyChdir() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("applyChdir() = %q, want %q", got, tt.want)
+			}
+			cwd, err := os.Getwd()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resolved, _ := filepath.EvalSymlinks(tt.wantDir); cwd != tt.wantDir && cwd != resolved {
+				t.Errorf("cwd = %s, want %s", cwd, tt.wantDir)
+			}
+		})
+	}
+}
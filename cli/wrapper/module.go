@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var semverRegex = regexp.MustCompile(`^\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// cliVersion returns the version of the cdkts CLI to run from JSR.
+// Defaults to cdkTsVersion but can be overridden with CDKTS_VERSION.
+func cliVersion() (string, error) {
+	version := os.Getenv("CDKTS_VERSION")
+	if version == "" {
+		return cdkTsVersion, nil
+	}
+	if !semverRegex.MatchString(version) {
+		return "", fmt.Errorf("CDKTS_VERSION %q is not a valid semver version", version)
+	}
+	return version, nil
+}
+
+// fileURLToPath converts a file:// URL to a native path.
+//
+//   - file:///C:/foo/main.ts becomes C:\foo\main.ts on Windows
+//   - file://server/share/main.ts becomes \\server\share\main.ts on Windows
+//   - file:///foo/main.ts becomes /foo/main.ts everywhere else
+func fileURLToPath(u *url.URL) (string, error) {
+	path := u.Path
+	host := u.Host
+	if host == "localhost" {
+		host = ""
+	}
+
+	if runtime.GOOS != "windows" {
+		if host != "" {
+			return "", fmt.Errorf("file URLs with a host are not supported: %s", u)
+		}
+		return path, nil
+	}
+
+	if host != "" {
+		return `\\` + host + filepath.FromSlash(path), nil
+	}
+
+	// file:///C:/foo parses to a path of /C:/foo
+	if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path), nil
+}
+
+// localMainPath resolves CDKTS_LOCAL_MAIN, a path or file:// URL pointing at
+// a local checkout of cli/main.ts, to an absolute path that exists.
+func localMainPath(value string) (string, error) {
+	path := value
+	if strings.HasPrefix(value, "file://") {
+		u, err := url.Parse(value)
+		if err != nil {
+			return "", fmt.Errorf("CDKTS_LOCAL_MAIN %q is not a valid URL: %w", value, err)
+		}
+		path, err = fileURLToPath(u)
+		if err != nil {
+			return "", fmt.Errorf("CDKTS_LOCAL_MAIN is invalid: %w", err)
+		}
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve CDKTS_LOCAL_MAIN: %w", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("CDKTS_LOCAL_MAIN is invalid: %w", err)
+	}
+	return path, nil
+}
+
+// cliSpecifier returns the module specifier deno should run. This is the CLI
+// published to JSR unless CDKTS_LOCAL_MAIN points at a local checkout.
+func cliSpecifier() (string, error) {
+	if localMain := os.Getenv("CDKTS_LOCAL_MAIN"); localMain != "" {
+		return localMainPath(localMain)
+	}
+
+	version, err := cliVersion()
+	if err != nil {
+		return "", err
+	}
+	// A mirror is still loaded as jsr:, so deno resolves the CLI's imports
+	// through its import map, applyRegistryEnv points JSR_URL at the mirror.
+	// It's validated here, so a bad one is reported before anything runs.
+	if _, err := registryBase(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("jsr:@brad-jones/cdkts@%s/cli", version), nil
+}
+
+// registryBase returns the base URL of the JSR registry, without a trailing
+// slash. CDKTS_REGISTRY_BASE replaces jsr.io with an internal mirror.
+func registryBase() (string, error) {
+	base := os.Getenv("CDKTS_REGISTRY_BASE")
+	if base == "" {
+		return jsrURL, nil
+	}
+	u, err := url.Parse(base)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("CDKTS_REGISTRY_BASE %q must be an https URL, eg: https://jsr.example.com", base)
+	}
+	return strings.TrimRight(base, "/"), nil
+}
+
+// moduleURL is the URL of the entrypoint of the given CLI version on the
+// registry at base. It's only for checking it's there, deno is always given
+// the jsr: specifier, see cliSpecifier.
+func moduleURL(base, version string) string {
+	return base + "/@brad-jones/cdkts/" + version + "/cli/main.ts"
+}
+
+// applyRegistryEnv points deno's own JSR_URL at CDKTS_REGISTRY_BASE, unless
+// the user has already set it, so the CLI's jsr: dependencies are fetched
+// from the mirror too.
+func applyRegistryEnv() {
+	if os.Getenv("CDKTS_REGISTRY_BASE") == "" || os.Getenv("JSR_URL") != "" {
+		return
+	}
+	if base, err := registryBase(); err == nil {
+		os.Setenv("JSR_URL", base+"/")
+	}
+}
+
+// lockArgs returns the deno flags that make it verify the CLI module against
+// the lock file named by CDKTS_LOCK, refusing to run if the integrity hash of
+// anything it downloads does not match.
+//
+// CDKTS_INTEGRITY pins just the CLI package instead, deno still verifies it
+// but is allowed to record its dependencies, so --frozen is not used.
+func lockArgs() ([]string, error) {
+	lockFile := os.Getenv("CDKTS_LOCK")
+	if integrity := os.Getenv("CDKTS_INTEGRITY"); integrity != "" {
+		if lockFile != "" {
+			return nil, fmt.Errorf("CDKTS_INTEGRITY and CDKTS_LOCK can not be used together")
+		}
+		path, err := writeIntegrityLock(integrity)
+		if err != nil {
+			return nil, err
+		}
+		return []string{"--lock=" + path}, nil
+	}
+	if lockFile == "" {
+		return nil, nil
+	}
+	path, err := filepath.Abs(lockFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve CDKTS_LOCK: %w", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("CDKTS_LOCK is invalid: %w", err)
+	}
+	return []string{"--lock=" + path, "--frozen"}, nil
+}
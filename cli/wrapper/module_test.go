@@ -0,0 +1,201 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestCliVersion(t *testing.T) {
+	tests := []struct {
+		env     string
+		want    string
+		wantErr bool
+	}{
+		{"", cdkTsVersion, false},
+		{"1.2.3", "1.2.3", false},
+		{"1.2.3-beta.1", "1.2.3-beta.1", false},
+		{"1.2.3+build.5", "1.2.3+build.5", false},
+		{"1.2", "", true},
+		{"latest", "", true},
+		{"1.2.3/../../evil", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv("CDKTS_VERSION", tt.env)
+			got, err := cliVersion()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cliVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("cliVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalMainPath(t *testing.T) {
+	dir := t.TempDir()
+	mainTs := filepath.Join(dir, "main.ts")
+	if err := os.WriteFile(mainTs, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	fileURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(mainTs)}).String()
+	if runtime.GOOS == "windows" {
+		fileURL = (&url.URL{Scheme: "file", Path: "/" + filepath.ToSlash(mainTs)}).String()
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"absolute", mainTs, false},
+		{"relative", "main.ts", false},
+		{"file url", fileURL, false},
+		{"missing", "missing.ts", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := localMainPath(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("localMainPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != mainTs {
+				t.Errorf("localMainPath() = %q, want %q", got, mainTs)
+			}
+		})
+	}
+}
+
+func TestFileURLToPath(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{"file:///home/test/main.ts", "/home/test/main.ts", false},
+		{"file://localhost/home/test/main.ts", "/home/test/main.ts", false},
+		{"file://server/share/main.ts", "", true},
+	}
+	if runtime.GOOS == "windows" {
+		tests = []struct {
+			url     string
+			want    string
+			wantErr bool
+		}{
+			{"file:///C:/Users/test/main.ts", `C:\Users\test\main.ts`, false},
+			{"file://localhost/C:/Users/test/main.ts", `C:\Users\test\main.ts`, false},
+			{"file://server/share/main.ts", `\\server\share\main.ts`, false},
+			{"file://server/share/dir%20name/main.ts", `\\server\share\dir name\main.ts`, false},
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := fileURLToPath(u)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fileURLToPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("fileURLToPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockArgs(t *testing.T) {
+	dir := t.TempDir()
+	lockFile := filepath.Join(dir, "deno.lock")
+	if err := os.WriteFile(lockFile, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	tests := []struct {
+		name    string
+		env     string
+		want    []string
+		wantErr bool
+	}{
+		{"unset", "", nil, false},
+		{"absolute", lockFile, []string{"--lock=" + lockFile, "--frozen"}, false},
+		{"relative", "deno.lock", []string{"--lock=" + lockFile, "--frozen"}, false},
+		{"missing", "missing.lock", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CDKTS_LOCK", tt.env)
+			got, err := lockArgs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lockArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("lockArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCliSpecifierRegistryBase(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		want    string
+		wantErr bool
+	}{
+		{"unset", "", "jsr:@brad-jones/cdkts@1.2.3/cli", false},
+		{"mirror", "https://jsr.example.com", "jsr:@brad-jones/cdkts@1.2.3/cli", false},
+		{"trailing slash", "https://jsr.example.com/", "jsr:@brad-jones/cdkts@1.2.3/cli", false},
+		{"sub path", "https://example.com/jsr//", "jsr:@brad-jones/cdkts@1.2.3/cli", false},
+		{"http", "http://jsr.example.com", "", true},
+		{"no host", "https:///jsr", "", true},
+		{"not a url", "jsr.example.com", "", true},
+		{"query", "https://jsr.example.com?token=x", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CDKTS_LOCAL_MAIN", "")
+			t.Setenv("CDKTS_VERSION", "1.2.3")
+			t.Setenv("CDKTS_REGISTRY_BASE", tt.base)
+			got, err := cliSpecifier()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cliSpecifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("cliSpecifier() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModuleURL(t *testing.T) {
+	tests := []struct {
+		base string
+		want string
+	}{
+		{"", "https://jsr.io/@brad-jones/cdkts/1.2.3/cli/main.ts"},
+		{"https://jsr.example.com/", "https://jsr.example.com/@brad-jones/cdkts/1.2.3/cli/main.ts"},
+		{"https://example.com/jsr//", "https://example.com/jsr/@brad-jones/cdkts/1.2.3/cli/main.ts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.base, func(t *testing.T) {
+			t.Setenv("CDKTS_REGISTRY_BASE", tt.base)
+			base, err := registryBase()
+			if err != nil {
+				t.Fatalf("registryBase() error = %v", err)
+			}
+			if got := moduleURL(base, "1.2.3"); got != tt.want {
+				t.Errorf("moduleURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package main
+
+import "syscall"
+
+// isNoexecMount reports whether dir is on a filesystem mounted noexec, eg: a
+// hardened /tmp, where deno could be extracted but never run.
+func isNoexecMount(dir string) bool {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return false
+	}
+	return stat.Flags&syscall.MS_NOEXEC != 0
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// isNoexecMount is only implemented on Linux, where hardened systems commonly
+// mount /tmp noexec.
+func isNoexecMount(dir string) bool {
+	return false
+}
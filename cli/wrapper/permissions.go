@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// permissionProfiles are the named sets of permissions CDKTS_DENO_PERMISSIONS
+// may be set to, instead of hand written flags.
+var permissionProfiles = map[string]func() ([]string, error){
+	"locked": lockedPermissions,
+}
+
+// denoPermissions returns the permission flags the CLI is run with. By default
+// that is -A, CDKTS_DENO_PERMISSIONS can narrow it to a specific set of
+// --allow-* / --deny-* flags, or one of permissionProfiles. Be aware that
+// narrowing permissions may break CLI features that need them, eg:
+// downloading tofu/terraform.
+func denoPermissions() ([]string, error) {
+	value := os.Getenv("CDKTS_DENO_PERMISSIONS")
+	if value == "" {
+		return []string{"-A"}, nil
+	}
+	if profile, ok := permissionProfiles[strings.TrimSpace(value)]; ok {
+		return profile()
+	}
+
+	// Only permission flags are allowed so this can't be used to smuggle in
+	// other deno flags, or worse a different script to run.
+	flags := strings.Fields(value)
+	for _, flag := range flags {
+		if !strings.HasPrefix(flag, "--allow-") && !strings.HasPrefix(flag, "--deny-") {
+			return nil, fmt.Errorf("CDKTS_DENO_PERMISSIONS may only contain --allow-* and --deny-* flags, got %q", flag)
+		}
+	}
+	return flags, nil
+}
+
+// lockedPermissions is a small set of permissions for synthesizing & deploying
+// a stack in the current directory with a tofu/terraform that's already
+// installed: read & write the current directory, the temp dir, where the CLI
+// keeps its project dir, and CDKTS_PROJECT_DIR if that's set instead, read the
+// environment, run tofu, terraform or CDKTS_TF_BINARY_PATH, and reach the
+// registry (jsr.io or CDKTS_REGISTRY_BASE) for the CLI's own dependencies.
+// tofu/terraform are separate processes, so they can still reach providers &
+// cloud APIs.
+func lockedPermissions() ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	dirs := []string{cwd, os.TempDir()}
+	if projectDir := os.Getenv("CDKTS_PROJECT_DIR"); projectDir != "" {
+		if projectDir, err = filepath.Abs(projectDir); err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, projectDir)
+	}
+	base, err := registryBase()
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+
+	run := []string{"tofu", "terraform"}
+	if path := os.Getenv("CDKTS_TF_BINARY_PATH"); path != "" {
+		run = append(run, path)
+	}
+	return []string{
+		"--allow-read=" + strings.Join(dirs, ","),
+		"--allow-write=" + strings.Join(dirs, ","),
+		"--allow-env",
+		"--allow-run=" + strings.Join(run, ","),
+		"--allow-net=" + u.Host,
+	}, nil
+}
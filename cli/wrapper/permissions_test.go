@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDenoPermissions(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		want    []string
+		wantErr bool
+	}{
+		{"default", "", []string{"-A"}, false},
+		{"narrowed", "--allow-read --allow-run=terraform  --allow-net=jsr.io", []string{"--allow-read", "--allow-run=terraform", "--allow-net=jsr.io"}, false},
+		{"deny", "--allow-all --deny-env", []string{"--allow-all", "--deny-env"}, false},
+		{"other flag", "--allow-read --config=evil.json", nil, true},
+		{"script", "--allow-read https://evil.com/main.ts", nil, true},
+		{"short flag", "-A", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CDKTS_DENO_PERMISSIONS", tt.env)
+			got, err := denoPermissions()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("denoPermissions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("denoPermissions() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenoPermissionsLocked(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TMPDIR", filepath.Join(dir, "tmp"))
+	tmp := os.TempDir()
+	dirs := cwd + "," + tmp
+	project := cwd + "," + tmp + "," + filepath.Join(cwd, "infra")
+
+	tests := []struct {
+		name       string
+		registry   string
+		tfBinary   string
+		projectDir string
+		want       []string
+		wantErr    bool
+	}{
+		{"jsr", "", "", "", []string{"--allow-read=" + dirs, "--allow-write=" + dirs, "--allow-env", "--allow-run=tofu,terraform", "--allow-net=jsr.io"}, false},
+		{"mirror", "https://jsr.example.com:8443/", "", "", []string{"--allow-read=" + dirs, "--allow-write=" + dirs, "--allow-env", "--allow-run=tofu,terraform", "--allow-net=jsr.example.com:8443"}, false},
+		{"tf binary", "", "/opt/tofu/bin/tofu", "", []string{"--allow-read=" + dirs, "--allow-write=" + dirs, "--allow-env", "--allow-run=tofu,terraform,/opt/tofu/bin/tofu", "--allow-net=jsr.io"}, false},
+		{"project dir", "", "", "infra", []string{"--allow-read=" + project, "--allow-write=" + project, "--allow-env", "--allow-run=tofu,terraform", "--allow-net=jsr.io"}, false},
+		{"bad mirror", "http://jsr.example.com", "", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CDKTS_DENO_PERMISSIONS", " locked ")
+			t.Setenv("CDKTS_REGISTRY_BASE", tt.registry)
+			t.Setenv("CDKTS_TF_BINARY_PATH", tt.tfBinary)
+			t.Setenv("CDKTS_PROJECT_DIR", tt.projectDir)
+			got, err := denoPermissions()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("denoPermissions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("denoPermissions() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
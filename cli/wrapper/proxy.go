@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const jsrURL = "https://jsr.io"
+
+var proxyEnvVars = []string{"HTTPS_PROXY", "HTTP_PROXY"}
+
+// applyProxyEnv maps CDKTS_PROXY onto the standard proxy variables, which deno
+// reads itself, unless the user has already set them.
+func applyProxyEnv() {
+	proxy := os.Getenv("CDKTS_PROXY")
+	if proxy == "" {
+		return
+	}
+	for _, name := range proxyEnvVars {
+		if os.Getenv(name) == "" && os.Getenv(strings.ToLower(name)) == "" {
+			os.Setenv(name, proxy)
+		}
+	}
+}
+
+// proxyConfigured reports whether any of the standard proxy variables are set.
+func proxyConfigured() bool {
+	for _, name := range proxyEnvVars {
+		if os.Getenv(name) != "" || os.Getenv(strings.ToLower(name)) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyURL returns the proxy deno will connect to for https, if there is one.
+// Like deno, a proxy without a scheme is taken to be http.
+func proxyURL() (*url.URL, bool) {
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "://") {
+			value = "http://" + value
+		}
+		u, err := url.Parse(value)
+		return u, err == nil && u.Host != ""
+	}
+	return nil, false
+}
+
+// registryReachable makes a short lived TCP connection to the registry at
+// base, a URL as returned by registryBase.
+func registryReachable(base string, timeout time.Duration) bool {
+	u, err := url.Parse(base)
+	if err != nil {
+		return false
+	}
+	return hostReachable(u, timeout)
+}
+
+// hostReachable makes a short lived TCP connection to the host of u.
+func hostReachable(u *url.URL, timeout time.Duration) bool {
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(u.Hostname(), port), timeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestApplyProxyEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantHTTP  string
+		wantHTTPS string
+	}{
+		{
+			name:      "unset",
+			env:       map[string]string{},
+			wantHTTP:  "",
+			wantHTTPS: "",
+		},
+		{
+			name:      "maps onto both",
+			env:       map[string]string{"CDKTS_PROXY": "http://proxy:3128"},
+			wantHTTP:  "http://proxy:3128",
+			wantHTTPS: "http://proxy:3128",
+		},
+		{
+			name:      "does not override existing",
+			env:       map[string]string{"CDKTS_PROXY": "http://proxy:3128", "HTTPS_PROXY": "http://other:8080"},
+			wantHTTP:  "http://proxy:3128",
+			wantHTTPS: "http://other:8080",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"CDKTS_PROXY", "HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+				t.Setenv(name, tt.env[name])
+			}
+			applyProxyEnv()
+			if got := os.Getenv("HTTP_PROXY"); got != tt.wantHTTP {
+				t.Errorf("HTTP_PROXY = %q, want %q", got, tt.wantHTTP)
+			}
+			if got := os.Getenv("HTTPS_PROXY"); got != tt.wantHTTPS {
+				t.Errorf("HTTPS_PROXY = %q, want %q", got, tt.wantHTTPS)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// ptyOutput connects a child's stdout & stderr to a pseudo terminal, for
+// CDKTS_FORCE_TTY, so that deno & tofu/terraform think they're writing to a
+// terminal, and keep their colors, even when our output is piped. Everything
+// written to the terminal is copied to out, usually our stdout.
+//
+// A terminal has only one output, so the child's stderr ends up on stdout.
+type ptyOutput struct {
+	master *os.File
+	slave  *os.File
+	out    io.Writer
+	done   chan struct{}
+}
+
+// attachPty redirects the output of cmd, which must not have started yet, to
+// out.
+func attachPty(cmd *exec.Cmd, out io.Writer) (*ptyOutput, error) {
+	master, slave, err := openPty()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	return &ptyOutput{master, slave, out, make(chan struct{})}, nil
+}
+
+// started begins copying the output once cmd has started (or failed to).
+func (p *ptyOutput) started() {
+	// Only the child may hold the slave end open, so that we see the end of
+	// its output once it, and anything it started, exits
+	p.slave.Close()
+	go func() {
+		defer close(p.done)
+		// Reading the master of a pty whose slave is closed fails with EIO,
+		// on Linux, rather than EOF, either way the output is over
+		io.Copy(p.out, p.master)
+	}()
+}
+
+// wait blocks until all the output has been copied.
+func (p *ptyOutput) wait() {
+	<-p.done
+	p.master.Close()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openPty allocates a pseudo terminal, returning its master & slave ends.
+// This is what posix_openpt, grantpt, unlockpt & ptsname do in libc. Output
+// post processing is turned off so that "\n" isn't turned into "\r\n", the
+// output is destined for a pipe or file after all.
+func openPty() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := ioctl(master, syscall.TIOCPTYGRANT, nil); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to grant pty: %w", err)
+	}
+	if err := ioctl(master, syscall.TIOCPTYUNLK, nil); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to unlock pty: %w", err)
+	}
+	name := make([]byte, 128)
+	if err := ioctl(master, syscall.TIOCPTYGNAME, unsafe.Pointer(&name[0])); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to get pty name: %w", err)
+	}
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+
+	slave, err := os.OpenFile(string(name), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	var termios syscall.Termios
+	err = ioctl(slave, syscall.TIOCGETA, unsafe.Pointer(&termios))
+	if err == nil {
+		termios.Oflag &^= syscall.OPOST
+		err = ioctl(slave, syscall.TIOCSETA, unsafe.Pointer(&termios))
+	}
+	if err != nil {
+		master.Close()
+		slave.Close()
+		return nil, nil, fmt.Errorf("failed to configure pty: %w", err)
+	}
+
+	return master, slave, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openPty allocates a pseudo terminal, returning its master & slave ends.
+// Output post processing is turned off so that "\n" isn't turned into "\r\n",
+// the output is destined for a pipe or file after all.
+func openPty() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to unlock pty: %w", err)
+	}
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to get pty number: %w", err)
+	}
+
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	var termios syscall.Termios
+	err = ioctl(slave, syscall.TCGETS, unsafe.Pointer(&termios))
+	if err == nil {
+		termios.Oflag &^= syscall.OPOST
+		err = ioctl(slave, syscall.TCSETS, unsafe.Pointer(&termios))
+	}
+	if err != nil {
+		master.Close()
+		slave.Close()
+		return nil, nil, fmt.Errorf("failed to configure pty: %w", err)
+	}
+
+	return master, slave, nil
+}
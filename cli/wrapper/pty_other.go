@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func openPty() (*os.File, *os.File, error) {
+	return nil, nil, fmt.Errorf("not supported on %s", runtime.GOOS)
+}
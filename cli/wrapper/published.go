@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// moduleExists makes a HEAD request for moduleURL, reporting whether it
+// exists. Anything but a 200 or 404 is an error, we can't tell either way.
+func moduleExists(client *http.Client, moduleURL string) (bool, error) {
+	resp, err := client.Head(moduleURL)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("unexpected status %s", resp.Status)
+}
+
+// publishedMarkerPath is where checkPublished records, in dir, that the CLI at
+// moduleURL exists, so it's only ever checked once.
+func publishedMarkerPath(dir, moduleURL string) string {
+	return filepath.Join(dir, "cdkts-published-"+sha256Sum([]byte(moduleURL))[:16])
+}
+
+// checkPublished makes sure the CLI version is on the registry at base the
+// first time it's used, so a typo in CDKTS_VERSION is reported clearly rather
+// than as deno's raw 404. Only a 404 is an error, if the registry can't be
+// asked deno is left to deal with it as usual.
+func checkPublished(client *http.Client, base, version, markerDir string) error {
+	moduleURL := moduleURL(base, version)
+	marker := publishedMarkerPath(markerDir, moduleURL)
+	if fileExists(marker) {
+		return nil
+	}
+
+	exists, err := moduleExists(client, moduleURL)
+	if err != nil {
+		debugf("unable to check %s exists: %v", moduleURL, err)
+		return nil
+	}
+	if !exists {
+		host := base
+		if u, err := url.Parse(base); err == nil {
+			host = u.Host
+		}
+		return fmt.Errorf("cdkts version %s not found on %s", version, host)
+	}
+
+	if err := os.MkdirAll(markerDir, 0700); err == nil {
+		os.WriteFile(marker, nil, 0644)
+	}
+	return nil
+}
+
+// checkRegistry runs checkPublished until the CLI version has been found,
+// after a quick check the registry is reachable at all. Being unable to reach
+// it is only warned about, and only when deno was just extracted, as the CLI
+// may well be cached already.
+func checkRegistry(client *http.Client, base, version, markerDir string, extracted bool) error {
+	if fileExists(publishedMarkerPath(markerDir, moduleURL(base, version))) {
+		return nil
+	}
+	if !proxyConfigured() && !registryReachable(base, 3*time.Second) {
+		if extracted {
+			warnf("unable to reach %s, if you are behind a proxy set HTTPS_PROXY or CDKTS_PROXY, or set CDKTS_OFFLINE if the CLI is already cached", moduleURL(base, version))
+		}
+		return nil
+	}
+	return checkPublished(client, base, version, markerDir)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCheckPublished(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/@brad-jones/cdkts/1.0.0/cli/main.ts":
+			w.WriteHeader(http.StatusOK)
+		case "/@brad-jones/cdkts/5.0.0/cli/main.ts":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	tests := []struct {
+		name     string
+		version  string
+		requests int32
+		wantErr  string
+	}{
+		{"published", "1.0.0", 1, ""},
+		{"cached", "1.0.0", 0, ""},
+		{"missing", "9.9.9", 1, "cdkts version 9.9.9 not found on " + host},
+		{"missing is not cached", "9.9.9", 1, "cdkts version 9.9.9 not found on " + host},
+		{"registry error", "5.0.0", 1, ""},
+		{"registry error is not cached", "5.0.0", 1, ""},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			err := checkPublished(server.Client(), server.URL, tt.version, dir)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("checkPublished() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("checkPublished() error = %v, want %q", err, tt.wantErr)
+			}
+			if got := requests.Load(); got != tt.requests {
+				t.Errorf("checkPublished() made %d requests, want %d", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestCheckRegistry(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path == "/@brad-jones/cdkts/1.0.0/cli/main.ts" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	// The reachability check connects without a TLS handshake
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	for _, name := range []string{"CDKTS_PROXY", "HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+		t.Setenv(name, "")
+	}
+
+	closed := httptest.NewTLSServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name      string
+		base      string
+		version   string
+		extracted bool
+		requests  int32
+		wantErr   bool
+		wantWarn  bool
+	}{
+		// A typo in CDKTS_VERSION is caught long after deno was extracted
+		{name: "missing, already extracted", base: server.URL, version: "9.9.9", requests: 1, wantErr: true},
+		{name: "published, already extracted", base: server.URL, version: "1.0.0", requests: 1},
+		{name: "published again", base: server.URL, version: "1.0.0", requests: 0},
+		{name: "unreachable", base: closed.URL, version: "1.0.0"},
+		{name: "unreachable, just extracted", base: closed.URL, version: "1.0.0", extracted: true, wantWarn: true},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			stderr := captureOutput(t, &os.Stderr)
+			err := checkRegistry(server.Client(), tt.base, tt.version, dir, tt.extracted)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkRegistry() error = %v, want error %t", err, tt.wantErr)
+			}
+			if got := requests.Load(); got != tt.requests {
+				t.Errorf("checkRegistry() made %d requests, want %d", got, tt.requests)
+			}
+			if warned := len(stderr()) > 0; warned != tt.wantWarn {
+				t.Errorf("checkRegistry() wrote %q to stderr, want output %t", stderr(), tt.wantWarn)
+			}
+		})
+	}
+}
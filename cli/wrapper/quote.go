@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"runtime"
+	"strings"
+	"unicode/utf16"
+)
+
+var shellSafeRegex = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes arg so that it can be copy pasted into a shell as a single
+// word. POSIX single quoting is used everywhere except Windows, where we follow
+// the rules of CommandLineToArgvW.
+func shellQuote(arg string) string {
+	if shellSafeRegex.MatchString(arg) {
+		return arg
+	}
+
+	if runtime.GOOS != "windows" {
+		return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return windowsQuote(arg)
+}
+
+// windowsQuote double quotes arg following the rules of CommandLineToArgvW.
+func windowsQuote(arg string) string {
+	// Backslashes are literal unless they precede a double quote, in which
+	// case they must be doubled and the quote itself escaped.
+	var b strings.Builder
+	b.WriteByte('"')
+	slashes := 0
+	for _, c := range arg {
+		switch c {
+		case '\\':
+			slashes++
+		case '"':
+			b.WriteString(strings.Repeat(`\`, slashes*2+1))
+			b.WriteRune(c)
+			slashes = 0
+		default:
+			b.WriteString(strings.Repeat(`\`, slashes))
+			b.WriteRune(c)
+			slashes = 0
+		}
+	}
+	b.WriteString(strings.Repeat(`\`, slashes*2))
+	b.WriteByte('"')
+	return b.String()
+}
+
+// windowsCommandLineLength returns the length, in UTF-16 code units, of the
+// command line Windows builds for argv. Like os/exec, args are only quoted
+// when they have to be.
+func windowsCommandLineLength(argv []string) int {
+	length := 0
+	for i, arg := range argv {
+		if arg == "" || strings.ContainsAny(arg, " \t\"") {
+			arg = windowsQuote(arg)
+		}
+		if i > 0 {
+			length++
+		}
+		length += len(utf16.Encode([]rune(arg)))
+	}
+	return length
+}
+
+// shellJoin quotes and joins a command line for display.
+func shellJoin(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellSplit splits s into words the way a POSIX shell would, honouring single
+// quotes, double quotes and backslash escapes. No expansion is performed.
+func shellSplit(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case quote == '"':
+			switch {
+			case c == '"':
+				quote = 0
+			case c == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\'):
+				// Inside double quotes a backslash only escapes " and \
+				i++
+				word.WriteRune(runes[i])
+			default:
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == '\\':
+			if i+1 == len(runes) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		arg         string
+		wantPosix   string
+		wantWindows string
+	}{
+		{"plain", "plain", "plain"},
+		{"--config=./deno.json", "--config=./deno.json", "--config=./deno.json"},
+		{"", "''", `""`},
+		{"with space", "'with space'", `"with space"`},
+		{"it's", `'it'\''s'`, `"it's"`},
+		{`say "hi"`, `'say "hi"'`, `"say \"hi\""`},
+		{`C:\dir with space\`, `'C:\dir with space\'`, `"C:\dir with space\\"`},
+		{"$HOME", "'$HOME'", `"$HOME"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			want := tt.wantPosix
+			if runtime.GOOS == "windows" {
+				want = tt.wantWindows
+			}
+			if got := shellQuote(tt.arg); got != want {
+				t.Errorf("shellQuote() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestShellSplit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"  --seed=1   --unstable-kv ", []string{"--seed=1", "--unstable-kv"}, false},
+		{`--v8-flags='--max-old-space-size=4096 --stack-size=2000'`, []string{"--v8-flags=--max-old-space-size=4096 --stack-size=2000"}, false},
+		{`--location="https://example.com/a b"`, []string{"--location=https://example.com/a b"}, false},
+		{`--cert="C:\certs\ca.pem"`, []string{`--cert=C:\certs\ca.pem`}, false},
+		{`"say \"hi\""`, []string{`say "hi"`}, false},
+		{`a\ b c`, []string{"a b", "c"}, false},
+		{`''`, []string{""}, false},
+		{`'unterminated`, nil, true},
+		{`trailing\`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := shellSplit(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("shellSplit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("shellSplit() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowsCommandLineLength(t *testing.T) {
+	tests := []struct {
+		argv []string
+		want int
+	}{
+		{[]string{"cdkts", "plan"}, 10},
+		{[]string{"cdkts", ""}, 8},
+		{[]string{"cdkts", "a b"}, 11},
+		{[]string{"cdkts", `C:\dir with space\`}, 27},
+		{[]string{"cdkts", "ünïcödé"}, 13},
+	}
+	for _, tt := range tests {
+		if got := windowsCommandLineLength(tt.argv); got != tt.want {
+			t.Errorf("windowsCommandLineLength(%q) = %d, want %d", tt.argv, got, tt.want)
+		}
+	}
+}
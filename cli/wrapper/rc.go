@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const rcFileName = ".cdktsrc"
+
+// rcKeys maps the keys of a .cdktsrc file to the environment variable they
+// provide a default for.
+var rcKeys = map[string]string{
+	"version":         "CDKTS_VERSION",
+	"registryBase":    "CDKTS_REGISTRY_BASE",
+	"proxy":           "CDKTS_PROXY",
+	"offline":         "CDKTS_OFFLINE",
+	"denoFlags":       "CDKTS_DENO_FLAGS",
+	"denoPermissions": "CDKTS_DENO_PERMISSIONS",
+	"lock":            "CDKTS_LOCK",
+	"integrity":       "CDKTS_INTEGRITY",
+	"cacheDir":        "CDKTS_CACHE_DIR",
+	"denoDir":         "CDKTS_DENO_DIR",
+	"timeout":         "CDKTS_TIMEOUT",
+	"noHints":         "CDKTS_NO_HINTS",
+	"useVersionFile":  "CDKTS_USE_VERSION_FILE",
+}
+
+// rcPathKeys are resolved relative to the .cdktsrc file they're set in, not
+// wherever cdkts happens to be run from.
+var rcPathKeys = map[string]bool{"lock": true, "cacheDir": true, "denoDir": true}
+
+// rcFiles returns the .cdktsrc files that exist, highest precedence first:
+// the nearest one in the current dir or its parents, then the home dir.
+func rcFiles() []string {
+	var files []string
+	if dir, err := os.Getwd(); err == nil {
+		for {
+			if path := filepath.Join(dir, rcFileName); fileExists(path) {
+				files = append(files, path)
+				break
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if path := filepath.Join(home, rcFileName); fileExists(path) && (len(files) == 0 || files[0] != path) {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// applyRcFiles loads every rcFiles, each of which only sets the environment
+// variables that are not already set. So the environment overrides the
+// project rc file which overrides the home one. Wrapper flags are checked
+// after this and so override everything.
+func applyRcFiles() error {
+	for _, path := range rcFiles() {
+		debugf("loading %s", path)
+		if err := applyRcFile(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyRcFile sets the defaults from a single .cdktsrc file.
+func applyRcFile(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var rc map[string]any
+	if err := json.Unmarshal(data, &rc); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for key, value := range rc {
+		name, ok := rcKeys[key]
+		if !ok {
+			warnf("ignoring unknown key %q in %s", key, path)
+			continue
+		}
+		if os.Getenv(name) != "" {
+			continue
+		}
+
+		var str string
+		switch v := value.(type) {
+		case string:
+			str = v
+		case bool:
+			str = strconv.FormatBool(v)
+		default:
+			return fmt.Errorf("%s: %q must be a string or boolean", path, key)
+		}
+		if rcPathKeys[key] && str != "" && !filepath.IsAbs(str) {
+			str = filepath.Join(filepath.Dir(path), str)
+		}
+		os.Setenv(name, str)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeRcFile(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, rcFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyRcFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	writeRcFile(t, home, `{"version": "1.0.0", "registryBase": "https://home.example.com", "denoFlags": "--seed=1"}`)
+
+	project := t.TempDir()
+	writeRcFile(t, project, `{"version": "2.0.0", "registryBase": "https://project.example.com", "lock": "deno.lock", "offline": true}`)
+	nested := filepath.Join(project, "stacks", "app")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(nested)
+
+	for _, name := range rcKeys {
+		t.Setenv(name, "")
+	}
+	t.Setenv("CDKTS_VERSION", "3.0.0")
+
+	if err := applyRcFiles(); err != nil {
+		t.Fatalf("applyRcFiles() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"CDKTS_VERSION", "3.0.0"},                             // env wins
+		{"CDKTS_REGISTRY_BASE", "https://project.example.com"}, // project beats home
+		{"CDKTS_DENO_FLAGS", "--seed=1"},                       // home fills the gaps
+		{"CDKTS_LOCK", filepath.Join(project, "deno.lock")},    // relative to the rc file
+		{"CDKTS_OFFLINE", "true"},
+		{"CDKTS_PROXY", ""},
+	}
+	for _, tt := range tests {
+		if got := os.Getenv(tt.name); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyRcFileInvalid(t *testing.T) {
+	tests := map[string]string{
+		"not json":   `version = "1.0.0"`,
+		"bad value":  `{"version": 1}`,
+		"not object": `["1.0.0"]`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeRcFile(t, dir, content)
+			t.Setenv("CDKTS_VERSION", "")
+			if err := applyRcFile(filepath.Join(dir, rcFileName)); err == nil {
+				t.Error("applyRcFile() expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// expandResponseFiles replaces every @file argument with the arguments read
+// from file, like many compilers do, so generated invocations can be tidier &
+// stay under Windows' command line limit.
+//
+// The file holds one or more arguments per line, see splitResponseFile. A
+// response file can't refer to another, and arguments after a "--" are
+// tofu/terraform's, so they're left alone.
+func expandResponseFiles(args []string) ([]string, error) {
+	var result []string
+	for i, arg := range args {
+		if arg == "--" {
+			return append(result, args[i:]...), nil
+		}
+		path, ok := strings.CutPrefix(arg, "@")
+		if !ok || path == "" {
+			result = append(result, arg)
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response file: %w", err)
+		}
+		expanded, err := splitResponseFile(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse response file %s: %w", path, err)
+		}
+		debugf("expanded %s to %q", arg, expanded)
+		result = append(result, expanded...)
+	}
+	return result, nil
+}
+
+// splitResponseFile splits s into arguments at whitespace, single or double
+// quotes grouping an argument that contains some. Unlike shellSplit a
+// backslash is literal, as in MSVC response files, so Windows paths need no
+// escaping. It only escapes a quote that follows it.
+func splitResponseFile(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\''):
+			i++
+			arg.WriteRune(runes[i])
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
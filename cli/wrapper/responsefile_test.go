@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExpandResponseFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	files := map[string]string{
+		"plan.args":    "plan\n./stack.ts\r\n\n--out='my plan.tfplan'\n",
+		"nested.args":  "@plan.args\n",
+		"bad.args":     "plan \"./stack.ts\n",
+		"windows.args": "plan\r\n--out=C:\\plans\\x.tfplan\r\n\"C:\\Program Files\\infra\\stack.ts\"\r\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{"none", []string{"plan", "./stack.ts"}, []string{"plan", "./stack.ts"}, false},
+		{"expanded in place", []string{"--wrapper-dry-run", "@plan.args", "--verbose"}, []string{"--wrapper-dry-run", "plan", "./stack.ts", "--out=my plan.tfplan", "--verbose"}, false},
+		{"windows paths", []string{"@windows.args"}, []string{"plan", `--out=C:\plans\x.tfplan`, `C:\Program Files\infra\stack.ts`}, false},
+		{"not nested", []string{"@nested.args"}, []string{"@plan.args"}, false},
+		{"after separator", []string{"plan", "--", "@plan.args"}, []string{"plan", "--", "@plan.args"}, false},
+		{"bare @", []string{"plan", "@"}, []string{"plan", "@"}, false},
+		{"missing", []string{"@missing.args"}, nil, true},
+		{"bad quoting", []string{"@bad.args"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandResponseFiles(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandResponseFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expandResponseFiles() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := expandResponseFiles([]string{"@missing.args"}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expandResponseFiles() error = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestSplitResponseFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{"lines & spaces", "plan ./stack.ts\n--verbose\r\n", []string{"plan", "./stack.ts", "--verbose"}, false},
+		{"backslashes are literal", `C:\plans\x.tfplan \\server\share`, []string{`C:\plans\x.tfplan`, `\\server\share`}, false},
+		{"quoted", `"my plan" 'their plan' --out="a b"`, []string{"my plan", "their plan", "--out=a b"}, false},
+		{"escaped quotes", `--name=\"x\" "say \"hi\""`, []string{`--name="x"`, `say "hi"`}, false},
+		{"empty quotes", `plan ""`, []string{"plan", ""}, false},
+		{"unterminated", `plan "./stack.ts`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitResponseFile(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitResponseFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("splitResponseFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
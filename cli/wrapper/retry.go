@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// isTransient reports whether err is a filesystem error that is likely to go
+// away on its own, eg: a file briefly held open by antivirus on Windows or a
+// busy networked filesystem. Permission errors are never transient.
+func isTransient(err error) bool {
+	for _, target := range transientErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryTransient calls fn up to attempts times, backing off exponentially from
+// delay between attempts, for as long as it fails with a transient error.
+func retryTransient(attempts int, delay time.Duration, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(); err == nil || !isTransient(err) {
+			return err
+		}
+		if attempt < attempts {
+			debugf("transient error, retrying in %s: %v", delay, err)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
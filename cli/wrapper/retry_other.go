@@ -0,0 +1,7 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+var transientErrors = []error{syscall.EBUSY, syscall.EAGAIN, syscall.ETXTBSY, syscall.EINTR}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"testing"
+	"time"
+)
+
+func TestRetryTransient(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"succeeds first time", 0, nil, 1, false},
+		{"recovers from transient", 2, transientErrors[0], 3, false},
+		{"gives up on transient", 5, transientErrors[0], 3, true},
+		{"does not retry permission denied", 5, fs.ErrPermission, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := retryTransient(3, time.Millisecond, func() error {
+				calls++
+				if calls <= tt.failures {
+					return fmt.Errorf("failed to write data: %w", tt.err)
+				}
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("retryTransient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("retryTransient() calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
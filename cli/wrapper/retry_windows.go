@@ -0,0 +1,7 @@
+package main
+
+import "syscall"
+
+const errorSharingViolation syscall.Errno = 32
+
+var transientErrors = []error{errorSharingViolation, errorLockViolation}
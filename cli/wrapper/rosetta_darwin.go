@@ -0,0 +1,11 @@
+package main
+
+import "syscall"
+
+// runningTranslated reports whether we are an amd64 process being run by
+// Rosetta 2 on Apple Silicon. The sysctl doesn't exist on older macOS or Intel
+// machines, in which case we can't be translated.
+func runningTranslated() bool {
+	value, err := syscall.SysctlUint32("sysctl.proc_translated")
+	return err == nil && value == 1
+}
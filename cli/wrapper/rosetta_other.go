@@ -0,0 +1,7 @@
+//go:build !darwin
+
+package main
+
+func runningTranslated() bool {
+	return false
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// parseDenoVersion extracts the version from the output of deno --version,
+// eg: "deno 2.5.6 (stable, release, x86_64-unknown-linux-gnu)" gives 2.5.6.
+func parseDenoVersion(output string) string {
+	line, _, _ := strings.Cut(output, "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != "deno" {
+		return ""
+	}
+	return fields[1]
+}
+
+// systemDeno returns the path of the deno on PATH when CDKTS_PREFER_SYSTEM_DENO
+// is set and it's exactly the version we embed, so there's no need to extract
+// our own copy. CDKTS_FORCE_EXTRACT takes precedence.
+func systemDeno() (string, bool) {
+	if !envBool("CDKTS_PREFER_SYSTEM_DENO") || envBool("CDKTS_FORCE_EXTRACT") {
+		return "", false
+	}
+	path, err := exec.LookPath("deno")
+	if err != nil {
+		debugf("no system deno: %v", err)
+		return "", false
+	}
+	out, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		debugf("failed to run system deno %s: %v", path, err)
+		return "", false
+	}
+	if version, want := parseDenoVersion(string(out)), embeddedDenoVersion(); version != want {
+		debugf("system deno %s is version %q, want %q", path, version, want)
+		return "", false
+	}
+	return path, true
+}
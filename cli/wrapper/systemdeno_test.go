@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseDenoVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"deno 2.5.6 (stable, release, x86_64-unknown-linux-gnu)\nv8 14.0.365.5-rusty\ntypescript 5.9.2\n", "2.5.6"},
+		{"deno 2.5.6-rc.1 (rc, release, aarch64-apple-darwin)\n", "2.5.6-rc.1"},
+		{"node v22.0.0\n", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := parseDenoVersion(tt.output); got != tt.want {
+			t.Errorf("parseDenoVersion(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestSystemDeno(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake deno is a shell script")
+	}
+	writeFakeDeno := func(t *testing.T, version string) string {
+		dir := t.TempDir()
+		script := "#!/bin/sh\necho 'deno " + version + " (stable, release, test)'\n"
+		if err := os.WriteFile(filepath.Join(dir, "deno"), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	original := denoVersion
+	t.Cleanup(func() { denoVersion = original })
+	denoVersion = "2.1.4"
+	embedded := denoVersion
+
+	tests := []struct {
+		name    string
+		version string
+		prefer  string
+		force   string
+		want    bool
+	}{
+		{"match", embedded, "1", "", true},
+		{"not opted in", embedded, "", "", false},
+		{"forced extraction", embedded, "1", "1", false},
+		{"other version", embedded + ".1", "1", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFakeDeno(t, tt.version)
+			t.Setenv("PATH", dir)
+			t.Setenv("CDKTS_PREFER_SYSTEM_DENO", tt.prefer)
+			t.Setenv("CDKTS_FORCE_EXTRACT", tt.force)
+
+			path, ok := systemDeno()
+			if ok != tt.want {
+				t.Fatalf("systemDeno() ok = %v, want %v", ok, tt.want)
+			}
+			if ok && path != filepath.Join(dir, "deno") {
+				t.Errorf("systemDeno() = %q, want the one on PATH", path)
+			}
+		})
+	}
+}
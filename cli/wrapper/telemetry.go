@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"time"
+)
+
+// telemetryReport is everything that's sent about a failure. It must never
+// include stack contents, paths, args or error messages, which may contain any
+// of those, just enough to tell which builds fail in which ways.
+type telemetryReport struct {
+	Category       string `json:"category"`
+	OS             string `json:"os"`
+	Arch           string `json:"arch"`
+	WrapperVersion string `json:"wrapperVersion"`
+	DenoVersion    string `json:"denoVersion"`
+}
+
+// reportFailure sends an anonymous report of a wrapper level failure, eg:
+// deno failing to extract, to CDKTS_TELEMETRY_URL. It's strictly opt in, doing
+// nothing unless CDKTS_TELEMETRY is set too. Failing to send is ignored.
+func reportFailure(category string) {
+	if !envBool("CDKTS_TELEMETRY") {
+		return
+	}
+	endpoint := os.Getenv("CDKTS_TELEMETRY_URL")
+	if endpoint == "" {
+		debugf("CDKTS_TELEMETRY is set but CDKTS_TELEMETRY_URL is not, nothing sent")
+		return
+	}
+	report := telemetryReport{
+		Category:       category,
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+		WrapperVersion: cdkTsVersion,
+		DenoVersion:    embeddedDenoVersion(),
+	}
+	if err := sendReport(endpoint, report, 2*time.Second); err != nil {
+		debugf("failed to send telemetry: %v", err)
+	}
+}
+
+// sendReport POSTs report to endpoint as JSON, giving up after timeout so a
+// slow collector only ever delays an exit that's already failing.
+func sendReport(endpoint string, report telemetryReport, timeout time.Duration) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("CDKTS_TELEMETRY_URL %q is not an http(s) URL", endpoint)
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestReportFailure(t *testing.T) {
+	var mu sync.Mutex
+	var reports []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Errorf("invalid report: %v", err)
+		}
+		mu.Lock()
+		reports = append(reports, report)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		telemetry string
+		url       string
+		wantSent  bool
+	}{
+		{"unset", "", server.URL, false},
+		{"disabled", "0", server.URL, false},
+		{"no url", "1", "", false},
+		{"bad url", "1", "ftp://example.com", false},
+		{"opted in", "1", server.URL, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reports = nil
+			t.Setenv("CDKTS_TELEMETRY", tt.telemetry)
+			t.Setenv("CDKTS_TELEMETRY_URL", tt.url)
+			reportFailure("extract")
+
+			if sent := len(reports) > 0; sent != tt.wantSent {
+				t.Fatalf("sent = %v, want %v", sent, tt.wantSent)
+			}
+			if !tt.wantSent {
+				return
+			}
+			want := map[string]string{
+				"category":       "extract",
+				"os":             runtime.GOOS,
+				"arch":           runtime.GOARCH,
+				"wrapperVersion": cdkTsVersion,
+				"denoVersion":    reports[0]["denoVersion"],
+			}
+			if len(reports[0]) != len(want) {
+				t.Errorf("report = %v, want only %v", reports[0], want)
+			}
+			for key, value := range want {
+				if reports[0][key] != value {
+					t.Errorf("report[%q] = %q, want %q", key, reports[0][key], value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// parseDenoVersionFile extracts the version from a .deno-version file, which
+// holds nothing but the version, optionally prefixed with a "v".
+func parseDenoVersionFile(data string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(data), "\n")
+	return strings.TrimPrefix(strings.TrimSpace(line), "v")
+}
+
+// parseToolVersions extracts the deno version from an asdf/mise .tool-versions
+// file, eg: "deno 2.5.6". Only the first version is used when fallbacks are
+// listed.
+func parseToolVersions(data string) string {
+	for _, line := range strings.Split(data, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "deno" {
+			return strings.TrimPrefix(fields[1], "v")
+		}
+	}
+	return ""
+}
+
+// pinnedDenoVersion returns the deno version pinned by the nearest
+// .deno-version or .tool-versions in the current dir or its parents, along
+// with the file it came from. A .tool-versions without deno in it is skipped.
+func pinnedDenoVersion() (string, string) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", ""
+	}
+	parsers := []struct {
+		name  string
+		parse func(string) string
+	}{
+		{".deno-version", parseDenoVersionFile},
+		{".tool-versions", parseToolVersions},
+	}
+	for {
+		for _, parser := range parsers {
+			path := filepath.Join(dir, parser.name)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			if version := parser.parse(string(data)); version != "" {
+				return version, path
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// versionManagerDirs returns where asdf & mise install tools, honouring their
+// own environment variables.
+func versionManagerDirs() []string {
+	home, _ := os.UserHomeDir()
+	asdf := os.Getenv("ASDF_DATA_DIR")
+	if asdf == "" && home != "" {
+		asdf = filepath.Join(home, ".asdf")
+	}
+	mise := os.Getenv("MISE_DATA_DIR")
+	if mise == "" {
+		if xdg := os.Getenv("XDG_DATA_HOME"); xdg != "" {
+			mise = filepath.Join(xdg, "mise")
+		} else if home != "" {
+			mise = filepath.Join(home, ".local", "share", "mise")
+		}
+	}
+	var dirs []string
+	for _, dir := range []string{mise, asdf} {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// versionFileDeno returns the path of the deno installed by asdf or mise for
+// the version pinned in the project, when CDKTS_USE_VERSION_FILE is set.
+// Nothing is installed for the user, without a matching install the embedded
+// deno is used as usual. CDKTS_FORCE_EXTRACT takes precedence.
+func versionFileDeno() (string, bool) {
+	if !envBool("CDKTS_USE_VERSION_FILE") || envBool("CDKTS_FORCE_EXTRACT") {
+		return "", false
+	}
+	version, file := pinnedDenoVersion()
+	if version == "" {
+		debugf("no .deno-version or .tool-versions pins deno")
+		return "", false
+	}
+	for _, dir := range versionManagerDirs() {
+		path := filepath.Join(dir, "installs", "deno", version, "bin", "deno"+exeSuffix())
+		if err := checkExecutable(path); err == nil {
+			debugf("using deno %s pinned by %s", version, file)
+			return path, true
+		}
+	}
+	debugf("deno %s pinned by %s is not installed, using the embedded deno", version, file)
+	return "", false
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseDenoVersionFile(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"2.5.6\n", "2.5.6"},
+		{"v2.5.6", "2.5.6"},
+		{"  2.5.6  \r\n", "2.5.6"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := parseDenoVersionFile(tt.data); got != tt.want {
+			t.Errorf("parseDenoVersionFile(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestParseToolVersions(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"deno 2.5.6\n", "2.5.6"},
+		{"nodejs 22.0.0\ndeno 2.5.6 2.4.0\n", "2.5.6"},
+		{"# deno 1.0.0\ndeno 2.5.6 # pinned\n", "2.5.6"},
+		{"deno v2.5.6\r\n", "2.5.6"},
+		{"denox 2.5.6\n", ""},
+		{"deno\n", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := parseToolVersions(tt.data); got != tt.want {
+			t.Errorf("parseToolVersions(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestVersionFileDeno(t *testing.T) {
+	writeFile := func(t *testing.T, path, data string, perm os.FileMode) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A project with .tool-versions at its root, run from a nested dir
+	project := t.TempDir()
+	writeFile(t, filepath.Join(project, ".tool-versions"), "nodejs 22.0.0\ndeno 2.5.6\n", 0644)
+	nested := filepath.Join(project, "stacks", "app")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	mise := t.TempDir()
+	installed := filepath.Join(mise, "installs", "deno", "2.5.6", "bin", "deno"+exeSuffix())
+	writeFile(t, installed, "", 0755)
+
+	tests := []struct {
+		name        string
+		use         string
+		force       string
+		denoVersion string
+		want        string
+	}{
+		{"installed", "1", "", "", installed},
+		{"not opted in", "", "", "", ""},
+		{"forced extraction", "1", "1", "", ""},
+		{"nearer .deno-version wins", "1", "", "2.5.6", installed},
+		{"not installed", "1", "", "1.0.0", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(nested)
+			t.Setenv("CDKTS_USE_VERSION_FILE", tt.use)
+			t.Setenv("CDKTS_FORCE_EXTRACT", tt.force)
+			t.Setenv("MISE_DATA_DIR", mise)
+			t.Setenv("ASDF_DATA_DIR", t.TempDir())
+			if tt.denoVersion != "" {
+				path := filepath.Join(nested, ".deno-version")
+				writeFile(t, path, tt.denoVersion, 0644)
+				t.Cleanup(func() { os.Remove(path) })
+			}
+
+			path, ok := versionFileDeno()
+			if ok != (tt.want != "") || path != tt.want {
+				t.Errorf("versionFileDeno() = %q, %t, want %q", path, ok, tt.want)
+			}
+		})
+	}
+}
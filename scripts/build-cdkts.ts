@@ -1,8 +1,9 @@
 #!/usr/bin/env -S deno run -qA --ext=ts
 import { Command } from "@cliffy/command";
 import { $ } from "@david/dax";
+import { encodeHex } from "@std/encoding/hex";
 import { emptyDir } from "@std/fs";
-import { join } from "@std/path";
+import { basename, dirname, join } from "@std/path";
 import { DenoDownloader } from "../lib/automate/downloader/deno.ts";
 
 function toGOARCH(arch: "x86_64" | "aarch64"): string {
@@ -16,7 +17,8 @@ function toGOARCH(arch: "x86_64" | "aarch64"): string {
 
 await new Command()
   .name("build-cdkts")
-  .action(async () => {
+  .option("--zstd", "Compress the embedded deno with zstd instead of gzip, for a smaller wrapper.")
+  .action(async ({ zstd }) => {
     const binDir = join(import.meta.dirname!, "../bin");
     await emptyDir(binDir);
 
@@ -50,18 +52,32 @@ await new Command()
       const suffix = platform === "windows" ? ".exe" : "";
       const denoBinary = await new DenoDownloader({ platform, arch }).getBinaryPath();
       await Deno.copyFile(denoBinary, `${cliDir}/deno`);
-      await $`gzip --best ${cliDir}/deno`;
+      // What the wrapper knows about the deno it embeds is set with ldflags, see extract.go
+      const denoSha256 = await crypto.subtle.digest("SHA-256", await Deno.readFile(denoBinary));
+      const ldflags = [
+        `-X main.denoSha256=${encodeHex(denoSha256)}`,
+        `-X main.denoVersion=${basename(dirname(denoBinary))}`,
+        `-X main.denoTarget=${platform}/${toGOARCH(arch)}`,
+        `-X main.denoSize=${(await Deno.stat(denoBinary)).size}`,
+      ].join(" ");
+      if (zstd) {
+        await $`zstd -q -19 --rm ${cliDir}/deno -o ${cliDir}/deno.zst`;
+      } else {
+        await $`gzip --best ${cliDir}/deno`;
+      }
       try {
         await $`
           CGO_ENABLED=0
           GOOS=${platform}
           GOARCH=${toGOARCH(arch)}
           go build -v
+          -tags ${zstd ? "zstd" : ""}
+          -ldflags ${ldflags}
           -o ${`${binDir}/cdkts_${platform}_${arch}${suffix}`}
-          ${`${cliDir}/main.go`}
+          ${cliDir}
         `;
       } finally {
-        await Deno.remove(`${cliDir}/deno.gz`);
+        await Deno.remove(`${cliDir}/${zstd ? "deno.zst" : "deno.gz"}`);
       }
     }
   })